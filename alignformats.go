@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// line widths used when wrapping alignments
+const (
+	fastaLineWidth   = 60
+	clustalLineWidth = 60
+	embossLineWidth  = 50
+)
+
+// SaveAlignment writes aligned rows in one of the supported formats ("fasta", "clustal", "stockholm" or "emboss")
+// stats is only used by the emboss format and qRes only by the stockholm format, either may be nil
+// if path is empty the file is named alignment with the default extension of the format
+func SaveAlignment(format, path string, names, rows []string, stats *AlignmentStats, qRes []float64) error {
+	var text string
+	var extension string
+	switch format {
+	case "fasta":
+		text, extension = FormatFASTA(names, rows), ".fasta"
+	case "clustal":
+		text, extension = FormatClustal(names, rows), ".aln"
+	case "stockholm":
+		text, extension = FormatStockholm(names, rows, qRes), ".sto"
+	case "emboss":
+		if len(rows) != 2 || stats == nil {
+			return fmt.Errorf("emboss format requires a pairwise alignment with statistics")
+		}
+		text, extension = FormatEMBOSS(names, rows, *stats), ".txt"
+	default:
+		return fmt.Errorf("unknown alignment format %q", format)
+	}
+	if path == "" {
+		path = "alignment" + extension
+	}
+	return os.WriteFile(path, []byte(text), 0644)
+}
+
+// FormatFASTA returns aligned rows as FASTA records with gaps kept and lines wrapped
+func FormatFASTA(names, rows []string) string {
+	var sb strings.Builder
+	for i, row := range rows {
+		sb.WriteString(">" + names[i] + "\n")
+		for start := 0; start < len(row); start += fastaLineWidth {
+			end := minInt(start+fastaLineWidth, len(row))
+			sb.WriteString(row[start:end] + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// FormatClustal returns aligned rows in Clustal format, with a conservation line under every block
+// ('*' identical column, ':' all pairs score positive in BLOSUM62, '.' no pair scores negative)
+func FormatClustal(names, rows []string) string {
+	var sb strings.Builder
+	sb.WriteString("CLUSTAL W multiple sequence alignment (GoMol)\n\n\n")
+	if len(rows) == 0 {
+		return sb.String()
+	}
+	width := nameWidth(names) + 6
+	conservation := clustalConservation(rows)
+	counts := make([]int, len(rows))
+	for start := 0; start < len(rows[0]); start += clustalLineWidth {
+		end := minInt(start+clustalLineWidth, len(rows[0]))
+		for i, row := range rows {
+			counts[i] += len(row[start:end]) - strings.Count(row[start:end], "-")
+			sb.WriteString(fmt.Sprintf("%-*s%s %d\n", width, names[i], row[start:end], counts[i]))
+		}
+		sb.WriteString(fmt.Sprintf("%-*s%s\n\n", width, "", conservation[start:end]))
+	}
+	return sb.String()
+}
+
+// FormatStockholm returns aligned rows in Stockholm format
+// qRes scores, one per alignment column as returned by ColumnQRes, are written for every sequence as a #=GR qRes line
+// with each score encoded as a digit from 0 (0.0-0.1) to 9 (0.9-1.0) and '.' in columns without a score
+func FormatStockholm(names, rows []string, qRes []float64) string {
+	var sb strings.Builder
+	sb.WriteString("# STOCKHOLM 1.0\n")
+	sb.WriteString("#=GF SQ " + fmt.Sprint(len(rows)) + "\n\n")
+	width := nameWidth(names) + len("#=GR  qRes ")
+	annotation := ""
+	if len(qRes) > 0 {
+		annotation = qResAnnotation(len(rows[0]), qRes)
+	}
+	for i, row := range rows {
+		sb.WriteString(fmt.Sprintf("%-*s%s\n", width, names[i], row))
+		if annotation != "" {
+			sb.WriteString(fmt.Sprintf("%-*s%s\n", width, "#=GR "+names[i]+" qRes", annotation))
+		}
+	}
+	sb.WriteString("//\n")
+	return sb.String()
+}
+
+// FormatEMBOSS returns a pairwise alignment in the EMBOSS needle text format: a header with
+// the alignment statistics followed by wrapped blocks with residue numbering
+func FormatEMBOSS(names, rows []string, stats AlignmentStats) string {
+	var sb strings.Builder
+	sb.WriteString("########################################\n")
+	sb.WriteString("# Program: GoMol\n")
+	sb.WriteString("# Aligned_sequences: 2\n")
+	sb.WriteString("# 1: " + names[0] + "\n")
+	sb.WriteString("# 2: " + names[1] + "\n")
+	sb.WriteString("# Matrix: BLOSUM62\n")
+	sb.WriteString(fmt.Sprintf("# Gap_penalty: %d\n", -gapPenalty))
+	sb.WriteString("#\n")
+	sb.WriteString(fmt.Sprintf("# Length: %d\n", stats.Length))
+	sb.WriteString(fmt.Sprintf("# Identity:   %6d/%d (%5.1f%%)\n", stats.Identities, stats.Length, percent(stats.Identities, stats.Length)))
+	sb.WriteString(fmt.Sprintf("# Similarity: %6d/%d (%5.1f%%)\n", stats.Positives, stats.Length, percent(stats.Positives, stats.Length)))
+	sb.WriteString(fmt.Sprintf("# Gaps:       %6d/%d (%5.1f%%)\n", stats.Gaps, stats.Length, percent(stats.Gaps, stats.Length)))
+	sb.WriteString(fmt.Sprintf("# Score: %d\n", stats.Score))
+	sb.WriteString("#\n#\n#=======================================\n\n")
+
+	markers := embossMarkers(rows[0], rows[1])
+	pos1, pos2 := 0, 0
+	for start := 0; start < len(rows[0]); start += embossLineWidth {
+		end := minInt(start+embossLineWidth, len(rows[0]))
+		block1, block2 := rows[0][start:end], rows[1][start:end]
+		start1, end1 := blockRange(block1, &pos1)
+		start2, end2 := blockRange(block2, &pos2)
+		sb.WriteString(fmt.Sprintf("%-13s %6d %s %6d\n", names[0], start1, block1, end1))
+		sb.WriteString(fmt.Sprintf("%-13s %6s %s\n", "", "", markers[start:end]))
+		sb.WriteString(fmt.Sprintf("%-13s %6d %s %6d\n\n", names[1], start2, block2, end2))
+	}
+	sb.WriteString("\n#---------------------------------------\n")
+	return sb.String()
+}
+
+// blockRange returns the 1-based number of the first and last residue in a block of an aligned row
+// pos holds the number of residues before the block and is advanced past it
+// blocks that are only gaps report the previous residue number for both ends, like EMBOSS
+func blockRange(block string, pos *int) (int, int) {
+	residues := len(block) - strings.Count(block, "-")
+	start := *pos + 1
+	*pos += residues
+	if residues == 0 {
+		return *pos, *pos
+	}
+	return start, *pos
+}
+
+// embossMarkers returns the EMBOSS match line: '|' identical, ':' positive score, '.' other pairs, ' ' gaps
+func embossMarkers(align1, align2 string) string {
+	markers := make([]byte, len(align1))
+	for i := range markers {
+		a, b := align1[i], align2[i]
+		switch {
+		case a == '-' || b == '-':
+			markers[i] = ' '
+		case a == b:
+			markers[i] = '|'
+		case score(rune(a), rune(b)) > 0:
+			markers[i] = ':'
+		default:
+			markers[i] = '.'
+		}
+	}
+	return string(markers)
+}
+
+// clustalConservation returns the Clustal conservation line for a set of aligned rows
+func clustalConservation(rows []string) string {
+	line := make([]byte, len(rows[0]))
+	for c := range line {
+		identical, positive, nonNegative := true, true, true
+		for i := 0; i < len(rows) && nonNegative; i++ {
+			if rows[i][c] == '-' {
+				identical, positive, nonNegative = false, false, false
+				break
+			}
+			for j := i + 1; j < len(rows); j++ {
+				if rows[j][c] == '-' {
+					identical, positive, nonNegative = false, false, false
+					break
+				}
+				pairScore := score(rune(rows[i][c]), rune(rows[j][c]))
+				identical = identical && rows[i][c] == rows[j][c]
+				positive = positive && pairScore > 0
+				nonNegative = nonNegative && pairScore >= 0
+			}
+		}
+		switch {
+		case identical:
+			line[c] = '*'
+		case positive:
+			line[c] = ':'
+		case nonNegative:
+			line[c] = '.'
+		default:
+			line[c] = ' '
+		}
+	}
+	return string(line)
+}
+
+// qResAnnotation encodes the qRes score of every column as a single digit, using '.' for columns without a score
+func qResAnnotation(columns int, qRes []float64) string {
+	line := make([]byte, columns)
+	for c := range line {
+		if c >= len(qRes) || math.IsNaN(qRes[c]) {
+			line[c] = '.'
+			continue
+		}
+		digit := int(qRes[c] * 10)
+		if digit < 0 {
+			digit = 0
+		} else if digit > 9 {
+			digit = 9
+		}
+		line[c] = byte('0' + digit)
+	}
+	return string(line)
+}
+
+// minInt returns the smaller of two integers
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// nameWidth returns the length of the longest name
+func nameWidth(names []string) int {
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	return width
+}
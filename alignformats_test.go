@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestFormatStockholm(t *testing.T) {
+	names := []string{"1abc", "2xyz"}
+	rows := []string{"AC-DEF", "ACKD-F"}
+	// one score per column, with no score for the gapped columns and for the last column, whose residue has
+	// no alpha carbon
+	qRes := []float64{0.95, 0.31, math.NaN(), 0.5, math.NaN(), math.NaN()}
+	want := strings.Join([]string{
+		"# STOCKHOLM 1.0",
+		"#=GF SQ 2",
+		"",
+		"1abc           AC-DEF",
+		"#=GR 1abc qRes 93.5..",
+		"2xyz           ACKD-F",
+		"#=GR 2xyz qRes 93.5..",
+		"//",
+	}, "\n") + "\n"
+	if got := FormatStockholm(names, rows, qRes); got != want {
+		t.Errorf("FormatStockholm() =\n%s\nwant\n%s", got, want)
+	}
+
+	want = strings.Join([]string{
+		"# STOCKHOLM 1.0",
+		"#=GF SQ 2",
+		"",
+		"1abc           AC-DEF",
+		"2xyz           ACKD-F",
+		"//",
+	}, "\n") + "\n"
+	if got := FormatStockholm(names, rows, nil); got != want {
+		t.Errorf("FormatStockholm() without qRes =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatEMBOSS(t *testing.T) {
+	if err := ReadBLOSUM62(); err != nil {
+		t.Fatal(err)
+	}
+	// a first block of 50 columns where the first row starts with gaps, and a second block where the second row
+	// is only gaps and so reports its previous residue number at both ends
+	rows := []string{
+		"--ACDEFGHIKLMNPQRSTVWYACDEFGHIKLMNPQRSTVWYACDEFGHIKLMNPQ----",
+		"MKACDEFGHIKLMNPQRSTVWYACDEFGHIKLMNPQRSTVWYACDEFGHV----------",
+	}
+	stats := AlignmentStats{Score: 159, Length: 60, Identities: 47, Positives: 48, Gaps: 12}
+	want := strings.Join([]string{
+		"########################################",
+		"# Program: GoMol",
+		"# Aligned_sequences: 2",
+		"# 1: 1abc",
+		"# 2: 2xyz",
+		"# Matrix: BLOSUM62",
+		"# Gap_penalty: 10",
+		"#",
+		"# Length: 60",
+		"# Identity:       47/60 ( 78.3%)",
+		"# Similarity:     48/60 ( 80.0%)",
+		"# Gaps:           12/60 ( 20.0%)",
+		"# Score: 159",
+		"#",
+		"#",
+		"#=======================================",
+		"",
+		"1abc               1 --ACDEFGHIKLMNPQRSTVWYACDEFGHIKLMNPQRSTVWYACDEFGHI     48",
+		"                       |||||||||||||||||||||||||||||||||||||||||||||||:",
+		"2xyz               1 MKACDEFGHIKLMNPQRSTVWYACDEFGHIKLMNPQRSTVWYACDEFGHV     50",
+		"",
+		"1abc              49 KLMNPQ----     54",
+		strings.Repeat(" ", 31),
+		"2xyz              50 ----------     50",
+		"",
+		"",
+		"#---------------------------------------",
+	}, "\n") + "\n"
+	if got := FormatEMBOSS([]string{"1abc", "2xyz"}, rows, stats); got != want {
+		t.Errorf("FormatEMBOSS() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadAlignment reads an alignment in FASTA or Clustal format and returns the sequence names and aligned rows
+// the format is detected from the first line that is neither empty nor a '#' comment, rows are upper-cased and '.'
+// gaps are converted to '-'
+func ReadAlignment(path string) ([]string, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	first := ""
+	for _, line := range lines {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			first = trimmed
+			break
+		}
+	}
+
+	var names, rows []string
+	switch {
+	case strings.HasPrefix(first, ">"):
+		names, rows = parseFASTA(lines)
+	case strings.HasPrefix(first, "CLUSTAL"):
+		names, rows = parseClustal(lines)
+	default:
+		return nil, nil, fmt.Errorf("%s: unrecognized alignment format, expected FASTA or Clustal", path)
+	}
+
+	for i := range rows {
+		rows[i] = strings.ToUpper(strings.ReplaceAll(rows[i], ".", "-"))
+		if len(rows[i]) != len(rows[0]) {
+			return nil, nil, fmt.Errorf("%s: row %s has length %d, expected %d", path, names[i], len(rows[i]), len(rows[0]))
+		}
+	}
+	return names, rows, nil
+}
+
+// parseFASTA collects the records of a FASTA file, joining wrapped sequence lines and skipping '#' comment lines
+func parseFASTA(lines []string) ([]string, []string) {
+	names := make([]string, 0)
+	rows := make([]string, 0)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, ">") {
+			fields := strings.Fields(line[1:])
+			name := ""
+			if len(fields) > 0 {
+				name = fields[0]
+			}
+			names = append(names, name)
+			rows = append(rows, "")
+			continue
+		}
+		if len(rows) > 0 {
+			rows[len(rows)-1] += strings.Join(strings.Fields(line), "")
+		}
+	}
+	return names, rows
+}
+
+// parseClustal collects the blocks of a Clustal file that follow the CLUSTAL header, skipping conservation lines
+func parseClustal(lines []string) ([]string, []string) {
+	names := make([]string, 0)
+	rows := make([]string, 0)
+	index := make(map[string]int)
+	header := 0
+	for header < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[header]), "CLUSTAL") {
+		header++
+	}
+	if header == len(lines) {
+		return names, rows
+	}
+	for _, line := range lines[header+1:] {
+		// conservation lines start with whitespace, sequence lines with the name
+		if strings.TrimSpace(line) == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		i, ok := index[fields[0]]
+		if !ok {
+			i = len(names)
+			index[fields[0]] = i
+			names = append(names, fields[0])
+			rows = append(rows, "")
+		}
+		rows[i] += fields[1]
+	}
+	return names, rows
+}
+
+// SelectAlignmentRows returns the two rows of an imported alignment that belong to the given PDB IDs
+// rows are matched by name (case insensitive); only when neither name matches is an alignment with exactly two
+// rows used in file order
+func SelectAlignmentRows(names, rows []string, id1, id2 string) (string, string, error) {
+	row1, row2 := -1, -1
+	for i, name := range names {
+		if strings.EqualFold(name, id1) && row1 == -1 {
+			row1 = i
+		} else if strings.EqualFold(name, id2) && row2 == -1 {
+			row2 = i
+		}
+	}
+	if row1 == -1 && row2 == -1 && len(rows) == 2 {
+		return rows[0], rows[1], nil
+	}
+	if row1 == -1 || row2 == -1 {
+		return "", "", fmt.Errorf("alignment has %d rows and no rows named %s and %s", len(rows), id1, id2)
+	}
+	return rows[row1], rows[row2], nil
+}
+
+// ValidateAlignmentRow checks that an aligned row with its gaps removed is identical to the structure's sequence
+// and returns a description of every mismatch, or nil when they agree
+func ValidateAlignmentRow(name, row, sequence string) []string {
+	mismatches := make([]string, 0)
+	gapless := strings.ReplaceAll(row, "-", "")
+	if len(gapless) != len(sequence) {
+		mismatches = append(mismatches, fmt.Sprintf("%s: alignment has %d residues but the structure has %d", name, len(gapless), len(sequence)))
+	}
+	for i := 0; i < len(gapless) && i < len(sequence); i++ {
+		if gapless[i] != sequence[i] {
+			mismatches = append(mismatches, fmt.Sprintf("%s: residue %d is %c in the alignment but %c in the structure", name, i+1, gapless[i], sequence[i]))
+		}
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	return mismatches
+}
+
+// MatchLine returns the match line for two aligned rows in the same style as NeedlemanWunsch
+func MatchLine(align1, align2 string) string {
+	line := make([]byte, len(align1))
+	for i := range line {
+		if align1[i] != '-' && align1[i] == align2[i] {
+			line[i] = '|'
+		} else {
+			line[i] = ' '
+		}
+	}
+	return string(line)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadAlignmentRoundTrip(t *testing.T) {
+	if err := ReadBLOSUM62(); err != nil {
+		t.Fatal(err)
+	}
+	// rows longer than a line so that the writers wrap them into several blocks
+	names := []string{"1mbn", "1mbo"}
+	rows := []string{
+		strings.Repeat("VLSEGEWQLVLHVWAKVEAD-", 8),
+		strings.Repeat("VLSEGEWQ-VLNVWGKVEADI", 8),
+	}
+	formats := map[string]string{
+		"fasta":               FormatFASTA(names, rows),
+		"clustal":             FormatClustal(names, rows),
+		"clustal after notes": "\n\n# written by hand\n" + FormatClustal(names, rows),
+	}
+	for format, text := range formats {
+		path := filepath.Join(t.TempDir(), "alignment")
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gotNames, gotRows, err := ReadAlignment(path)
+		if err != nil {
+			t.Fatalf("ReadAlignment of %s: %v", format, err)
+		}
+		if len(gotRows) != len(rows) {
+			t.Fatalf("ReadAlignment of %s returned %d rows, want %d", format, len(gotRows), len(rows))
+		}
+		for i := range rows {
+			if gotNames[i] != names[i] || gotRows[i] != rows[i] {
+				t.Errorf("ReadAlignment of %s row %d = %s %s, want %s %s", format, i, gotNames[i], gotRows[i], names[i], rows[i])
+			}
+		}
+	}
+}
+
+func TestReadAlignmentFASTAComments(t *testing.T) {
+	text := "# exported by hand\n>1mbn first\n# wrapped below\nVLSE-GEW\n#QLVL\nQLVL\n>1mbo\nVLSEAGEW\n\n# trailing note\nQ-VL\n"
+	path := filepath.Join(t.TempDir(), "alignment.fasta")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	names, rows, err := ReadAlignment(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames, wantRows := []string{"1mbn", "1mbo"}, []string{"VLSE-GEWQLVL", "VLSEAGEWQ-VL"}
+	if strings.Join(names, " ") != strings.Join(wantNames, " ") || strings.Join(rows, " ") != strings.Join(wantRows, " ") {
+		t.Errorf("ReadAlignment() = %q %q, want %q %q", names, rows, wantNames, wantRows)
+	}
+}
+
+func TestSelectAlignmentRows(t *testing.T) {
+	tests := []struct {
+		names      []string
+		id1, id2   string
+		want1      string
+		want2      string
+		shouldFail bool
+	}{
+		// names decide the rows even when the file lists them the other way round
+		{[]string{"2XYZ", "1abc"}, "1abc", "2xyz", "B", "A", false},
+		{[]string{"1abc", "other", "2xyz"}, "1abc", "2xyz", "A", "C", false},
+		// the same structure twice takes the first two rows named after it
+		{[]string{"1abc", "1abc"}, "1abc", "1abc", "A", "B", false},
+		// two rows named after neither structure are used in file order
+		{[]string{"seq1", "seq2"}, "1abc", "2xyz", "A", "B", false},
+		// a single matching name does not fall back to file order
+		{[]string{"2xyz", "seq2"}, "1abc", "2xyz", "", "", true},
+		{[]string{"seq1", "seq2", "seq3"}, "1abc", "2xyz", "", "", true},
+	}
+	for _, test := range tests {
+		rows := []string{"A", "B", "C"}[:len(test.names)]
+		row1, row2, err := SelectAlignmentRows(test.names, rows, test.id1, test.id2)
+		if (err != nil) != test.shouldFail {
+			t.Errorf("SelectAlignmentRows(%q, %s, %s) error = %v, want failure %v", test.names, test.id1, test.id2, err, test.shouldFail)
+			continue
+		}
+		if row1 != test.want1 || row2 != test.want2 {
+			t.Errorf("SelectAlignmentRows(%q, %s, %s) = %s %s, want %s %s", test.names, test.id1, test.id2, row1, row2, test.want1, test.want2)
+		}
+	}
+}
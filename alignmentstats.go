@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// AlignmentStats summarizes a pairwise alignment produced by NeedlemanWunsch
+type AlignmentStats struct {
+	Score           int     // raw alignment score (BLOSUM62 + linear gap penalty)
+	Length          int     // number of alignment columns
+	AlignedColumns  int     // columns where neither sequence has a gap
+	Identities      int     // identical residue pairs
+	Positives       int     // residue pairs with a positive BLOSUM62 score
+	Gaps            int     // gap characters over both sequences
+	GapOpens        int     // number of contiguous gap runs over both sequences
+	IdentityShorter float64 // percent identity relative to the shorter sequence
+	IdentityAligned float64 // percent identity relative to the aligned (gapless) columns
+	Similarity      float64 // percent of aligned columns with a positive score
+	Coverage1       float64 // percent of sequence 1 residues aligned to a residue
+	Coverage2       float64 // percent of sequence 2 residues aligned to a residue
+	ZScore          float64 // (score - mean shuffled score) / sd of shuffled scores
+	PValue          float64 // probability of a shuffled score at least this high (Gumbel fit)
+	EValue          float64 // expected number of shuffled scores at least this high (Gumbel fit)
+	Shuffles        int     // shuffled alignments behind the significance fields, zero when not estimated
+}
+
+// AlignmentStatistics takes as input the two original sequences and their alignment and returns
+// the score, identity, similarity, gap and coverage statistics of the alignment
+// significance fields are left at zero, see EstimateSignificance
+func AlignmentStatistics(seq1, seq2, align1, align2 string) AlignmentStats {
+	var stats AlignmentStats
+	stats.Length = len(align1)
+	inGap1, inGap2 := false, false
+	for i := 0; i < len(align1); i++ {
+		a, b := align1[i], align2[i]
+		if a == '-' || b == '-' {
+			stats.Score += gapPenalty
+			stats.Gaps++
+			if a == '-' && !inGap1 {
+				stats.GapOpens++
+			}
+			if b == '-' && !inGap2 {
+				stats.GapOpens++
+			}
+			inGap1, inGap2 = a == '-', b == '-'
+			continue
+		}
+		inGap1, inGap2 = false, false
+		pairScore := score(rune(a), rune(b))
+		stats.Score += pairScore
+		stats.AlignedColumns++
+		if a == b {
+			stats.Identities++
+		}
+		if pairScore > 0 {
+			stats.Positives++
+		}
+	}
+
+	shorter := len(seq1)
+	if len(seq2) < shorter {
+		shorter = len(seq2)
+	}
+	stats.IdentityShorter = percent(stats.Identities, shorter)
+	stats.IdentityAligned = percent(stats.Identities, stats.AlignedColumns)
+	stats.Similarity = percent(stats.Positives, stats.AlignedColumns)
+	stats.Coverage1 = percent(stats.AlignedColumns, len(seq1))
+	stats.Coverage2 = percent(stats.AlignedColumns, len(seq2))
+	return stats
+}
+
+// EstimateSignificance fills in the z-score, p-value and E-value of an alignment score by aligning
+// seq1 against shuffled copies of seq2 in parallel
+// the p-value and E-value come from fitting an extreme value (Gumbel) distribution to the shuffled scores
+func EstimateSignificance(stats *AlignmentStats, seq1, seq2 string, shuffles, numProcs int) {
+	if shuffles < 2 || len(seq1) == 0 || len(seq2) == 0 {
+		return
+	}
+	if numProcs < 1 {
+		numProcs = 1
+	}
+	scores := ShuffledScores(seq1, seq2, shuffles, numProcs)
+
+	mean, sd := MeanStdDev(scores)
+	if sd == 0 {
+		return
+	}
+	stats.ZScore = (float64(stats.Score) - mean) / sd
+	stats.Shuffles = shuffles
+
+	// method of moments fit of a Gumbel distribution
+	lambda := math.Pi / (sd * math.Sqrt(6))
+	mu := mean - 0.5772156649/lambda
+	stats.EValue = math.Exp(-lambda * (float64(stats.Score) - mu))
+	stats.PValue = 1 - math.Exp(-stats.EValue)
+}
+
+// ShuffledScores aligns seq1 against shuffles copies of seq2 with its residues permuted and
+// returns the alignment scores; the work is split over numProcs goroutines
+func ShuffledScores(seq1, seq2 string, shuffles, numProcs int) []float64 {
+	scores := make([]float64, shuffles)
+	finished := make(chan bool, numProcs)
+	for p := 0; p < numProcs; p++ {
+		start := p * shuffles / numProcs
+		end := (p + 1) * shuffles / numProcs
+		go func(p, start, end int) {
+			// every worker has its own source, math/rand sources are not safe for concurrent use
+			rng := rand.New(rand.NewSource(int64(shuffleSeed + p)))
+			shuffled := []byte(seq2)
+			for k := start; k < end; k++ {
+				rng.Shuffle(len(shuffled), func(i, j int) {
+					shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+				})
+				scores[k] = float64(NeedlemanWunschScore(seq1, string(shuffled)))
+			}
+			finished <- true
+		}(p, start, end)
+	}
+	for p := 0; p < numProcs; p++ {
+		<-finished
+	}
+	return scores
+}
+
+// MeanStdDev returns the mean and sample standard deviation of a slice of floats
+func MeanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(values) - 1)
+	return mean, math.Sqrt(variance)
+}
+
+// PrintAlignmentStats prints alignment statistics in a human readable form
+func PrintAlignmentStats(stats AlignmentStats) {
+	fmt.Printf("Alignment score: %d\n", stats.Score)
+	fmt.Printf("Alignment length: %d (%d aligned columns)\n", stats.Length, stats.AlignedColumns)
+	fmt.Printf("Identity (shorter sequence): %d (%.2f%%)\n", stats.Identities, stats.IdentityShorter)
+	fmt.Printf("Identity (aligned columns): %.2f%%\n", stats.IdentityAligned)
+	fmt.Printf("Similarity: %d (%.2f%%)\n", stats.Positives, stats.Similarity)
+	fmt.Printf("Gaps: %d (%d gap opens)\n", stats.Gaps, stats.GapOpens)
+	fmt.Printf("Coverage: %.2f%% of sequence 1, %.2f%% of sequence 2\n", stats.Coverage1, stats.Coverage2)
+	if stats.Shuffles > 0 {
+		fmt.Printf("Z-score: %.2f, P-value: %.3g, E-value: %.3g (%d shuffles)\n", stats.ZScore, stats.PValue, stats.EValue, stats.Shuffles)
+	}
+	fmt.Println()
+}
+
+// percent returns count / total as a percentage, or zero when total is zero
+func percent(count, total int) float64 {
+	if total == 0 {
+		return 0.0
+	}
+	return float64(count) / float64(total) * 100
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+)
+
+type AlignmentStatsTest struct {
+	seq1, seq2     string
+	align1, align2 string
+	result         AlignmentStats
+}
+
+func TestAlignmentStatistics(t *testing.T) {
+	if err := ReadBLOSUM62(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []AlignmentStatsTest{
+		{"HEAGAWGHEE", "PAWHEAE", "HEAGAWGHE-E", "--P-AW-HEAE",
+			AlignmentStats{Score: -18, Length: 11, AlignedColumns: 6, Identities: 5, Positives: 5, Gaps: 5, GapOpens: 4}},
+		{"KKVF", "KKVF", "KKVF", "KKVF",
+			AlignmentStats{Score: 20, Length: 4, AlignedColumns: 4, Identities: 4, Positives: 4}},
+	}
+	for _, test := range tests {
+		ourAnswer := AlignmentStatistics(test.seq1, test.seq2, test.align1, test.align2)
+		if ourAnswer.Score != test.result.Score || ourAnswer.Length != test.result.Length ||
+			ourAnswer.AlignedColumns != test.result.AlignedColumns || ourAnswer.Identities != test.result.Identities ||
+			ourAnswer.Positives != test.result.Positives || ourAnswer.Gaps != test.result.Gaps ||
+			ourAnswer.GapOpens != test.result.GapOpens {
+			t.Errorf("AlignmentStatistics(%s, %s) = %+v, want %+v", test.align1, test.align2, ourAnswer, test.result)
+		}
+	}
+}
+
+func TestNeedlemanWunschScore(t *testing.T) {
+	if err := ReadBLOSUM62(); err != nil {
+		t.Fatal(err)
+	}
+	pairs := [][2]string{{"HEAGAWGHEE", "PAWHEAE"}, {"KKVFGRCELAAAKRHG", "KVFERCELARTLKRLG"}}
+	for _, pair := range pairs {
+		align1, align2, _, _ := NeedlemanWunsch(pair[0], pair[1])
+		want := AlignmentStatistics(pair[0], pair[1], align1, align2).Score
+		if got := NeedlemanWunschScore(pair[0], pair[1]); got != want {
+			t.Errorf("NeedlemanWunschScore(%s, %s) = %d, want %d", pair[0], pair[1], got, want)
+		}
+	}
+}
+
+func TestBLOSUM62Diagonal(t *testing.T) {
+	// identical residues score the diagonal of BLOSUM62, which ReadBLOSUM62 once skipped and left at zero
+	if err := ReadBLOSUM62(); err != nil {
+		t.Fatal(err)
+	}
+	diagonal := map[rune]int{
+		'A': 4, 'R': 5, 'N': 6, 'D': 6, 'C': 9, 'Q': 5, 'E': 5, 'G': 6, 'H': 8, 'I': 4,
+		'L': 4, 'K': 5, 'M': 5, 'F': 6, 'P': 7, 'S': 4, 'T': 5, 'W': 11, 'Y': 7, 'V': 4,
+	}
+	for amino, want := range diagonal {
+		if got := score(amino, amino); got != want {
+			t.Errorf("score(%c, %c) = %d, want %d", amino, amino, got, want)
+		}
+	}
+	if got := NeedlemanWunschScore("WCH", "WCH"); got != 28 {
+		t.Errorf("NeedlemanWunschScore(WCH, WCH) = %d, want 28", got)
+	}
+}
+
+func TestEstimateSignificanceOptIn(t *testing.T) {
+	if err := ReadBLOSUM62(); err != nil {
+		t.Fatal(err)
+	}
+	seq1, seq2 := "KKVFGRCELAAAKRHG", "KVFERCELARTLKRLG"
+	align1, align2, _, _ := NeedlemanWunsch(seq1, seq2)
+	stats := AlignmentStatistics(seq1, seq2, align1, align2)
+	EstimateSignificance(&stats, seq1, seq2, 0, 2)
+	if stats.Shuffles != 0 || stats.ZScore != 0 {
+		t.Errorf("EstimateSignificance with no shuffles set Shuffles %d and ZScore %v, want zero", stats.Shuffles, stats.ZScore)
+	}
+	EstimateSignificance(&stats, seq1, seq2, 50, 2)
+	if stats.Shuffles != 50 || stats.ZScore <= 0 {
+		t.Errorf("EstimateSignificance with 50 shuffles set Shuffles %d and ZScore %v, want 50 and a positive z-score", stats.Shuffles, stats.ZScore)
+	}
+}
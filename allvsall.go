@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strings"
+)
+
+// ComparisonMatrix holds the results of comparing every pair of a set of structures
+type ComparisonMatrix struct {
+	Names    []string
+	RMSD     [][]float64 // CA RMSD after superposition of the aligned residues
+	TMScore  [][]float64 // TMScore[i][j] is normalized by the length of structure i
+	Identity [][]float64 // percent identity over aligned columns
+}
+
+// RunAllVsAll compares every pair of the given PDB IDs, writes the RMSD, TM-score and identity matrices as CSV
+// and clusters the structures by the chosen metric and linkage, writing the dendrogram in Newick format
+func RunAllVsAll(pdbIDs []string, metric, linkage string, numWorkers int) {
+	if err := ValidateClustering(metric, linkage); err != nil {
+		log.Fatal(err)
+	}
+	allAtoms := make([][]*Atom, len(pdbIDs))
+	for i, id := range pdbIDs {
+		allAtoms[i] = ParsePDB(FetchPDB(id))
+	}
+
+	matrix := AllVsAll(pdbIDs, allAtoms, numWorkers)
+	for name, values := range map[string][][]float64{
+		"rmsd_matrix.csv":     matrix.RMSD,
+		"tmscore_matrix.csv":  matrix.TMScore,
+		"identity_matrix.csv": matrix.Identity,
+	} {
+		if err := os.WriteFile(name, []byte(MatrixCSV(matrix.Names, values)), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	dist, err := matrix.Distances(metric)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tree, err := HierarchicalClustering(dist, linkage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	newick := Newick(tree, matrix.Names)
+	fmt.Printf("%s linkage clustering by %s: %s\n", linkage, metric, newick)
+	if err := os.WriteFile("clusters.nwk", []byte(newick+"\n"), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ValidateClustering checks the clustering metric and linkage, so that a typo fails before any structure is
+// fetched or compared
+func ValidateClustering(metric, linkage string) error {
+	switch metric {
+	case "rmsd", "tm", "identity":
+	default:
+		return fmt.Errorf("unknown clustering metric %q (use rmsd, tm or identity)", metric)
+	}
+	switch linkage {
+	case "single", "average", "complete":
+	default:
+		return fmt.Errorf("unknown linkage %q (use single, average or complete)", linkage)
+	}
+	return nil
+}
+
+// AllVsAll aligns and superposes every pair of structures using a pool of numWorkers goroutines
+func AllVsAll(names []string, allAtoms [][]*Atom, numWorkers int) *ComparisonMatrix {
+	n := len(allAtoms)
+	matrix := &ComparisonMatrix{Names: names, RMSD: squareMatrix(n), TMScore: squareMatrix(n), Identity: squareMatrix(n)}
+	seqs := make([]string, n)
+	residues := make([][]Residue, n)
+	for i, atoms := range allAtoms {
+		seqs[i] = GetQuerySequence(atoms)
+		residues[i] = Residues(atoms)
+		matrix.TMScore[i][i] = 1
+		matrix.Identity[i][i] = 100
+	}
+
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	pairs := make(chan [2]int, numWorkers)
+	finished := make(chan bool, numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func() {
+			for pair := range pairs {
+				i, j := pair[0], pair[1]
+				align1, align2, _, _ := NeedlemanWunsch(seqs[i], seqs[j])
+				stats := AlignmentStatistics(seqs[i], seqs[j], align1, align2)
+				ca1, ca2 := PairAtomSet(ResidueCorrespondences(align1, align2, residues[i], residues[j]), "ca")
+				fixed, mobile := AtomCoordinates(ca1), AtomCoordinates(ca2)
+				_, rmsd := QCPSuperpose(fixed, mobile, nil)
+				step := maxInt(1, len(fixed)/40)
+				tm1, _ := TMScoreSearch(fixed, mobile, len(residues[i]), step)
+				tm2, _ := TMScoreSearch(fixed, mobile, len(residues[j]), step)
+
+				matrix.RMSD[i][j], matrix.RMSD[j][i] = rmsd, rmsd
+				matrix.TMScore[i][j], matrix.TMScore[j][i] = tm1, tm2
+				matrix.Identity[i][j], matrix.Identity[j][i] = stats.IdentityAligned, stats.IdentityAligned
+			}
+			finished <- true
+		}()
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			pairs <- [2]int{i, j}
+		}
+	}
+	close(pairs)
+	for w := 0; w < numWorkers; w++ {
+		<-finished
+	}
+	return matrix
+}
+
+// Distances converts one of the comparison matrices to a symmetric distance matrix for clustering:
+// the RMSD itself, 1 - the mean of both TM-score normalizations, or 1 - fractional identity
+func (matrix *ComparisonMatrix) Distances(metric string) ([][]float64, error) {
+	n := len(matrix.Names)
+	dist := squareMatrix(n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if i == j {
+				continue
+			}
+			switch metric {
+			case "rmsd":
+				dist[i][j] = matrix.RMSD[i][j]
+			case "tm":
+				dist[i][j] = 1 - (matrix.TMScore[i][j]+matrix.TMScore[j][i])/2
+			case "identity":
+				dist[i][j] = 1 - matrix.Identity[i][j]/100
+			default:
+				return nil, fmt.Errorf("unknown clustering metric %q (use rmsd, tm or identity)", metric)
+			}
+		}
+	}
+	return dist, nil
+}
+
+// HierarchicalClustering builds a rooted dendrogram by agglomerative clustering of a distance matrix with single,
+// average or complete linkage; as in UPGMA the height of a merge is half the linkage distance
+func HierarchicalClustering(dist [][]float64, linkage string) (*GuideTreeNode, error) {
+	if linkage != "single" && linkage != "average" && linkage != "complete" {
+		return nil, fmt.Errorf("unknown linkage %q (use single, average or complete)", linkage)
+	}
+	n := len(dist)
+	nodes := make([]*GuideTreeNode, n)
+	sizes := make([]int, n)
+	heights := make([]float64, n)
+	d := copyDistances(dist)
+	for i := range nodes {
+		nodes[i] = &GuideTreeNode{Leaf: i}
+		sizes[i] = 1
+	}
+	for active := n; active > 1; active-- {
+		a, b := closestPair(d, nodes)
+		height := d[a][b] / 2
+		joined := &GuideTreeNode{Left: nodes[a], Right: nodes[b], Leaf: -1}
+		nodes[a].Length = math.Max(0, height-heights[a])
+		nodes[b].Length = math.Max(0, height-heights[b])
+		for k := range nodes {
+			if nodes[k] == nil || k == a || k == b {
+				continue
+			}
+			switch linkage {
+			case "single":
+				d[a][k] = math.Min(d[a][k], d[b][k])
+			case "complete":
+				d[a][k] = math.Max(d[a][k], d[b][k])
+			default:
+				d[a][k] = (d[a][k]*float64(sizes[a]) + d[b][k]*float64(sizes[b])) / float64(sizes[a]+sizes[b])
+			}
+			d[k][a] = d[a][k]
+		}
+		nodes[a] = joined
+		nodes[b] = nil
+		sizes[a] += sizes[b]
+		heights[a] = height
+	}
+	return firstNode(nodes), nil
+}
+
+// closestPair returns the indices of the two active clusters with the smallest distance
+func closestPair(d [][]float64, nodes []*GuideTreeNode) (int, int) {
+	a, b := -1, -1
+	best := math.Inf(1)
+	for i := range nodes {
+		for j := i + 1; j < len(nodes); j++ {
+			if nodes[i] == nil || nodes[j] == nil {
+				continue
+			}
+			if d[i][j] < best {
+				best, a, b = d[i][j], i, j
+			}
+		}
+	}
+	return a, b
+}
+
+// firstNode returns the first remaining (non nil) node
+func firstNode(nodes []*GuideTreeNode) *GuideTreeNode {
+	for _, node := range nodes {
+		if node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
+// MatrixCSV returns a square matrix as comma separated values with the structure names as row and column labels
+func MatrixCSV(names []string, values [][]float64) string {
+	var sb strings.Builder
+	WriteMatrixCSV(&sb, names, func(i int) []float64 { return values[i] })
+	return sb.String()
+}
+
+// WriteMatrixCSV writes a square matrix produced one row at a time as comma separated values with the names as
+// row and column labels, so that large matrices never need to be held in memory
+func WriteMatrixCSV(w io.Writer, names []string, row func(i int) []float64) error {
+	if _, err := fmt.Fprint(w, "id"); err != nil {
+		return err
+	}
+	for _, name := range names {
+		fmt.Fprint(w, ","+name)
+	}
+	fmt.Fprintln(w)
+	for i, name := range names {
+		fmt.Fprint(w, name)
+		for _, v := range row(i) {
+			fmt.Fprintf(w, ",%.4f", v)
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// squareMatrix returns an n by n matrix of zeros
+func squareMatrix(n int) [][]float64 {
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n)
+	}
+	return m
+}
@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestHierarchicalClustering(t *testing.T) {
+	names := []string{"A", "B", "C", "D"}
+	dist := [][]float64{
+		{0, 2, 6, 10},
+		{2, 0, 8, 10},
+		{6, 8, 0, 4},
+		{10, 10, 4, 0},
+	}
+	// A and B merge first, then C and D; only the height of the root depends on the linkage
+	tests := []struct {
+		linkage string
+		want    string
+	}{
+		{"single", "((A:1.0000,B:1.0000):2.0000,(C:2.0000,D:2.0000):1.0000):0.0000;"},
+		{"average", "((A:1.0000,B:1.0000):3.2500,(C:2.0000,D:2.0000):2.2500):0.0000;"},
+		{"complete", "((A:1.0000,B:1.0000):4.0000,(C:2.0000,D:2.0000):3.0000):0.0000;"},
+	}
+	for _, test := range tests {
+		tree, err := HierarchicalClustering(dist, test.linkage)
+		if err != nil {
+			t.Fatalf("HierarchicalClustering(%s): %v", test.linkage, err)
+		}
+		if got := Newick(tree, names); got != test.want {
+			t.Errorf("HierarchicalClustering(%s) = %s, want %s", test.linkage, got, test.want)
+		}
+	}
+
+	if got, want := Newick(UPGMA(dist), names), tests[1].want; got != want {
+		t.Errorf("UPGMA = %s, want the average linkage tree %s", got, want)
+	}
+	if _, err := HierarchicalClustering(dist, "ward"); err == nil {
+		t.Errorf("HierarchicalClustering(ward) returned no error")
+	}
+}
+
+func TestValidateClustering(t *testing.T) {
+	tests := []struct {
+		metric, linkage string
+		valid           bool
+	}{
+		{"rmsd", "single", true},
+		{"tm", "average", true},
+		{"identity", "complete", true},
+		{"gdt", "average", false},
+		{"tm", "ward", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		if err := ValidateClustering(test.metric, test.linkage); (err == nil) != test.valid {
+			t.Errorf("ValidateClustering(%q, %q) = %v, want valid %v", test.metric, test.linkage, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// atom sets that can be used for superposition and RMSD
+var atomSetNames = []string{"ca", "backbone", "cb", "heavy"}
+
+// symmetricAtoms lists the side chain atom names that are interchangeable by symmetry; the pairs of a residue
+// are swapped together, so the ring of PHE and TYR flips as a whole
+var symmetricAtoms = map[string][][2]string{
+	"ASP": {{"OD1", "OD2"}},
+	"GLU": {{"OE1", "OE2"}},
+	"PHE": {{"CD1", "CD2"}, {"CE1", "CE2"}},
+	"TYR": {{"CD1", "CD2"}, {"CE1", "CE2"}},
+	"ARG": {{"NH1", "NH2"}},
+	"LEU": {{"CD1", "CD2"}},
+	"VAL": {{"CG1", "CG2"}},
+}
+
+// ValidateAtomSet returns an error unless set is one of ca, backbone, cb or heavy
+func ValidateAtomSet(set string) error {
+	for _, name := range atomSetNames {
+		if set == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown atom set %q (use ca, backbone, cb or heavy)", set)
+}
+
+// InAtomSet reports whether an atom belongs to an atom set: ca for alpha carbons, backbone for N, CA, C and O,
+// cb for beta carbons (alpha carbons for glycine) and heavy for every non-hydrogen atom
+func InAtomSet(atom *Atom, set string) bool {
+	switch set {
+	case "ca":
+		return atom.element == "CA"
+	case "backbone":
+		return atom.element == "N" || atom.element == "CA" || atom.element == "C" || atom.element == "O"
+	case "cb":
+		return atom.element == "CB" || (atom.amino == "GLY" && atom.element == "CA")
+	case "heavy":
+		return atom.symbol != "H" && atom.symbol != "D"
+	}
+	return false
+}
+
+// PairAtomSet returns the atoms of an atom set for every aligned residue pair, matched by atom name after
+// resolving the naming of symmetric side chain atoms; atoms without a partner are skipped
+func PairAtomSet(correspondences []ResidueCorrespondence, set string) ([]*Atom, []*Atom) {
+	pairedAtoms1 := []*Atom{}
+	pairedAtoms2 := []*Atom{}
+	for _, c := range AlignedResiduePairs(correspondences) {
+		names := SymmetricNames(c.Res1, c.Res2)
+		for _, atom1 := range c.Res1.atoms {
+			if !InAtomSet(atom1, set) {
+				continue
+			}
+			name := atom1.element
+			if swapped, ok := names[name]; ok {
+				name = swapped
+			}
+			if atom2 := residueAtom(c.Res2, name); atom2 != nil {
+				pairedAtoms1 = append(pairedAtoms1, atom1)
+				pairedAtoms2 = append(pairedAtoms2, atom2)
+			}
+		}
+	}
+	return pairedAtoms1, pairedAtoms2
+}
+
+// SymmetricNames decides whether the symmetric atoms of res2 are named the other way round from those of res1 by
+// comparing their distances to the remaining atoms of the residue, which needs no superposition
+// it returns the name in res2 to pair with each swapped name of res1, or nil when the naming already agrees
+func SymmetricNames(res1, res2 *Residue) map[string]string {
+	groups, ok := symmetricAtoms[res1.amino]
+	if !ok || res1.amino != res2.amino {
+		return nil
+	}
+	swapped := make(map[string]string)
+	for _, pair := range groups {
+		swapped[pair[0]], swapped[pair[1]] = pair[1], pair[0]
+	}
+
+	keep, swap := 0.0, 0.0
+	for name, other := range swapped {
+		a1, a2, b2 := residueAtom(res1, name), residueAtom(res2, name), residueAtom(res2, other)
+		if a1 == nil || a2 == nil || b2 == nil {
+			return nil
+		}
+		for _, k1 := range res1.atoms {
+			if _, symmetric := swapped[k1.element]; symmetric {
+				continue
+			}
+			k2 := residueAtom(res2, k1.element)
+			if k2 == nil {
+				continue
+			}
+			d := Distance(a1, k1)
+			keep += math.Abs(d - Distance(a2, k2))
+			swap += math.Abs(d - Distance(b2, k2))
+		}
+	}
+	if swap < keep {
+		return swapped
+	}
+	return nil
+}
+
+// residueAtom returns the atom of a residue with the given name, or nil if it has none
+func residueAtom(res *Residue, name string) *Atom {
+	for _, atom := range res.atoms {
+		if atom.element == name {
+			return atom
+		}
+	}
+	return nil
+}
+
+// RenderedAtoms returns the atoms drawn by the ray tracer: alpha carbons, backbone nitrogens and oxygens
+// and sulfur, so that keeping every heavy atom for analysis does not slow down rendering
+func RenderedAtoms(atoms []*Atom) []*Atom {
+	rendered := make([]*Atom, 0, len(atoms))
+	for _, atom := range atoms {
+		if atom.element == "CA" || atom.element == "N" || atom.element == "O" || atom.symbol == "S" {
+			rendered = append(rendered, atom)
+		}
+	}
+	return rendered
+}
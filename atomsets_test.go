@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestSymmetricNames(t *testing.T) {
+	reference := ParsePDB("pdbfiles/1mbn.pdb")
+	// the same structure with the symmetric atoms of every residue named the other way round
+	renamed := ParsePDB("pdbfiles/1mbn.pdb")
+	for _, res := range Residues(renamed) {
+		for _, pair := range symmetricAtoms[res.amino] {
+			a, b := residueAtom(&res, pair[0]), residueAtom(&res, pair[1])
+			if a != nil && b != nil {
+				a.element, b.element = b.element, a.element
+			}
+		}
+	}
+
+	checked := 0
+	for _, c := range AlignedResiduePairs(identicalCorrespondences(reference, renamed)) {
+		groups, symmetric := symmetricAtoms[c.Res1.amino]
+		if !symmetric {
+			continue
+		}
+		checked++
+		if names := SymmetricNames(c.Res1, c.Res1); names != nil {
+			t.Errorf("SymmetricNames of %s %d with itself = %v, want nil", c.Res1.amino, c.Res1.resSeq, names)
+		}
+		names := SymmetricNames(c.Res1, c.Res2)
+		for _, pair := range groups {
+			if names[pair[0]] != pair[1] || names[pair[1]] != pair[0] {
+				t.Errorf("SymmetricNames of renamed %s %d = %v, want %s and %s swapped", c.Res1.amino, c.Res1.resSeq, names, pair[0], pair[1])
+			}
+		}
+	}
+	if checked == 0 {
+		t.Fatal("1mbn has no residues with symmetric atoms")
+	}
+
+	// pairing by resolved names puts every heavy atom on its own position again
+	atoms1, atoms2 := PairAtomSet(identicalCorrespondences(reference, renamed), "heavy")
+	if len(atoms1) == 0 {
+		t.Fatal("PairAtomSet paired no atoms")
+	}
+	for i := range atoms1 {
+		if d := Distance(atoms1[i], atoms2[i]); d > 1e-9 {
+			t.Errorf("PairAtomSet paired %s %d %s with an atom %.3f angstroms away", atoms1[i].amino, atoms1[i].resSeq, atoms1[i].element, d)
+		}
+	}
+}
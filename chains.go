@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Chain holds the atoms and sequence of one chain of a structure
+type Chain struct {
+	id       string
+	atoms    []*Atom
+	sequence string
+}
+
+// ChainPair is a chain of structure 1 matched to a chain of structure 2 together with their alignment
+type ChainPair struct {
+	Chain1, Chain2 *Chain
+	Score          int
+	Align1, Align2 string
+}
+
+// SplitChains takes as input a slice of atoms and returns its chains in the order they appear,
+// each with its own amino acid sequence
+func SplitChains(atoms []*Atom) []*Chain {
+	chains := make([]*Chain, 0)
+	index := make(map[string]int)
+	for _, atom := range atoms {
+		i, ok := index[atom.chain]
+		if !ok {
+			i = len(chains)
+			index[atom.chain] = i
+			chains = append(chains, &Chain{id: atom.chain})
+		}
+		chains[i].atoms = append(chains[i].atoms, atom)
+	}
+	for _, chain := range chains {
+		chain.sequence = GetQuerySequence(chain.atoms)
+	}
+	return chains
+}
+
+// ChainScoreMatrix returns the Needleman-Wunsch score of every chain of structure 1 against every chain of
+// structure 2, splitting the alignments over numProcs goroutines
+func ChainScoreMatrix(chains1, chains2 []*Chain, numProcs int) [][]int {
+	scores := make([][]int, len(chains1))
+	for i := range scores {
+		scores[i] = make([]int, len(chains2))
+	}
+	total := len(chains1) * len(chains2)
+	if numProcs < 1 {
+		numProcs = 1
+	}
+	finished := make(chan bool, numProcs)
+	for p := 0; p < numProcs; p++ {
+		start := p * total / numProcs
+		end := (p + 1) * total / numProcs
+		go func(start, end int) {
+			for k := start; k < end; k++ {
+				i, j := k/len(chains2), k%len(chains2)
+				scores[i][j] = NeedlemanWunschScore(chains1[i].sequence, chains2[j].sequence)
+			}
+			finished <- true
+		}(start, end)
+	}
+	for p := 0; p < numProcs; p++ {
+		<-finished
+	}
+	return scores
+}
+
+// PairChains matches the chains of two structures so that the summed alignment score is maximal
+// and aligns every matched pair; chains left without a partner are not included
+func PairChains(atoms1, atoms2 []*Atom, numProcs int) []ChainPair {
+	chains1 := SplitChains(atoms1)
+	chains2 := SplitChains(atoms2)
+	scores := ChainScoreMatrix(chains1, chains2, numProcs)
+
+	// the Hungarian algorithm minimizes, so negate the scores
+	cost := make([][]float64, len(chains1))
+	for i := range cost {
+		cost[i] = make([]float64, len(chains2))
+		for j := range cost[i] {
+			cost[i][j] = -float64(scores[i][j])
+		}
+	}
+	assignment := HungarianAssignment(cost)
+
+	pairs := make([]ChainPair, 0)
+	for i, j := range assignment {
+		if j < 0 {
+			continue
+		}
+		align1, align2, _, _ := NeedlemanWunsch(chains1[i].sequence, chains2[j].sequence)
+		pairs = append(pairs, ChainPair{chains1[i], chains2[j], scores[i][j], align1, align2})
+	}
+	return pairs
+}
+
+// HungarianAssignment solves the assignment problem for a rows x cols cost matrix and returns, for every row,
+// the column assigned to it or -1 if the row is left unassigned (when there are more rows than columns)
+func HungarianAssignment(cost [][]float64) []int {
+	rows := len(cost)
+	if rows == 0 {
+		return []int{}
+	}
+	cols := len(cost[0])
+	n := rows
+	if cols > n {
+		n = cols
+	}
+	// pad to a square matrix with zero cost dummy rows/columns, using 1-based indices as in the classic formulation
+	a := make([][]float64, n+1)
+	for i := range a {
+		a[i] = make([]float64, n+1)
+	}
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			a[i+1][j+1] = cost[i][j]
+		}
+	}
+
+	u := make([]float64, n+1)
+	v := make([]float64, n+1)
+	p := make([]int, n+1) // p[j] is the row matched to column j
+	way := make([]int, n+1)
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		minv := make([]float64, n+1)
+		used := make([]bool, n+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+		for p[j0] != 0 {
+			used[j0] = true
+			i0 := p[j0]
+			delta := math.Inf(1)
+			j1 := 0
+			for j := 1; j <= n; j++ {
+				if used[j] {
+					continue
+				}
+				cur := a[i0][j] - u[i0] - v[j]
+				if cur < minv[j] {
+					minv[j] = cur
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= n; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+
+	assignment := make([]int, rows)
+	for i := range assignment {
+		assignment[i] = -1
+	}
+	for j := 1; j <= n; j++ {
+		if p[j] >= 1 && p[j] <= rows && j <= cols {
+			assignment[p[j]-1] = j - 1
+		}
+	}
+	return assignment
+}
+
+// ComplexAlignment joins the alignments of all chain pairs into a single pair of aligned sequences
+func ComplexAlignment(pairs []ChainPair) (string, string) {
+	align1, align2 := "", ""
+	for _, pair := range pairs {
+		align1 += pair.Align1
+		align2 += pair.Align2
+	}
+	return align1, align2
+}
+
+// ComplexSequences joins the sequences of the paired chains in pair order, the sequences that ComplexAlignment aligns
+func ComplexSequences(pairs []ChainPair) (string, string) {
+	sequence1, sequence2 := "", ""
+	for _, pair := range pairs {
+		sequence1 += pair.Chain1.sequence
+		sequence2 += pair.Chain2.sequence
+	}
+	return sequence1, sequence2
+}
+
+// ComplexCorrespondences returns the residue correspondences of every chain pair joined in pair order, with the
+// columns of ComplexAlignment; residues of chains without a partner are not included
+func ComplexCorrespondences(pairs []ChainPair) []ResidueCorrespondence {
+	correspondences := []ResidueCorrespondence{}
+	for _, pair := range pairs {
+		offset := len(correspondences)
+		for _, c := range ResidueCorrespondences(pair.Align1, pair.Align2, Residues(pair.Chain1.atoms), Residues(pair.Chain2.atoms)) {
+			c.Column += offset
+			correspondences = append(correspondences, c)
+		}
+	}
+	return correspondences
+}
+
+// ComplexAlignedAtoms returns the aligned atoms of every chain pair concatenated in pair order,
+// ready to be superposed as a whole complex with RunKabsch
+func ComplexAlignedAtoms(pairs []ChainPair, atomSet string) ([]*Atom, []*Atom) {
+	alignedAtoms1 := []*Atom{}
+	alignedAtoms2 := []*Atom{}
+	for _, pair := range pairs {
+		a1, a2 := FilterAlignedAtoms(pair.Chain1.sequence, pair.Chain2.sequence, pair.Align1, pair.Align2, pair.Chain1.atoms, pair.Chain2.atoms, atomSet)
+		alignedAtoms1 = append(alignedAtoms1, a1...)
+		alignedAtoms2 = append(alignedAtoms2, a2...)
+	}
+	return alignedAtoms1, alignedAtoms2
+}
+
+// ValidateChainMode returns an error when the alignment options cannot be combined: chain mode builds its own
+// chain by chain alignment, so it excludes an imported, structural or secondary structure alignment, and the
+// interface comparison of -dockq needs the chain pairs of chain mode
+func ValidateChainMode(alignFile string, structural, ssMode, chainMode, dockQ bool) error {
+	if chainMode {
+		others := []string{}
+		if alignFile != "" {
+			others = append(others, "-alignment")
+		}
+		if structural {
+			others = append(others, "-structural")
+		}
+		if ssMode {
+			others = append(others, "-ss")
+		}
+		if len(others) > 0 {
+			return fmt.Errorf("-chains aligns chain by chain and cannot be combined with %s", strings.Join(others, " or "))
+		}
+	}
+	if dockQ && !chainMode {
+		return fmt.Errorf("-dockq needs -chains to pair the chains of the two structures")
+	}
+	return nil
+}
+
+// PrintChainPairs prints the chain mapping with the alignment score and identity of every pair
+func PrintChainPairs(pairs []ChainPair) {
+	fmt.Println("Chain mapping:")
+	for _, pair := range pairs {
+		stats := AlignmentStatistics(pair.Chain1.sequence, pair.Chain2.sequence, pair.Align1, pair.Align2)
+		fmt.Printf("  %s -> %s  score %d, identity %.2f%%\n", pair.Chain1.id, pair.Chain2.id, pair.Score, stats.IdentityShorter)
+	}
+	fmt.Println()
+}
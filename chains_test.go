@@ -0,0 +1,184 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// joinChains parses every PDB file and joins them into one structure with one chain per file, named by the
+// given IDs; residue indices are renumbered so that they stay unique across the joined chains
+func joinChains(t *testing.T, chains ...[2]string) []*Atom {
+	t.Helper()
+	atoms := []*Atom{}
+	offset := 0
+	for _, chain := range chains {
+		parsed := ParsePDB("pdbfiles/" + chain[1] + ".pdb")
+		if len(parsed) == 0 {
+			t.Fatalf("no atoms in %s", chain[1])
+		}
+		for _, atom := range parsed {
+			atom.chain = chain[0]
+			atom.seqIndex += offset
+		}
+		offset = parsed[len(parsed)-1].seqIndex + 1
+		atoms = append(atoms, parsed...)
+	}
+	return atoms
+}
+
+func TestHungarianAssignment(t *testing.T) {
+	tests := []struct {
+		cost [][]float64
+		want []int
+	}{
+		{[][]float64{{4, 1}, {2, 0}, {5, 5}}, []int{1, 0, -1}},
+		{[][]float64{{4, 2, 5}, {1, 0, 5}}, []int{1, 0}},
+		{[][]float64{{3}}, []int{0}},
+	}
+	for _, test := range tests {
+		got := HungarianAssignment(test.cost)
+		if !sameIndices(got, test.want) {
+			t.Errorf("HungarianAssignment(%v) = %v, want %v", test.cost, got, test.want)
+		}
+	}
+
+	// random rectangular matrices against the cheapest assignment found by trying every one
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 50; trial++ {
+		rows, cols := 1+rng.Intn(5), 1+rng.Intn(5)
+		cost := make([][]float64, rows)
+		for i := range cost {
+			cost[i] = make([]float64, cols)
+			for j := range cost[i] {
+				cost[i][j] = float64(rng.Intn(20) - 10)
+			}
+		}
+		got, want := assignmentCost(cost, HungarianAssignment(cost)), bruteForceAssignment(cost, 0, make([]bool, cols))
+		if math.Abs(got-want) > 1e-9 {
+			t.Errorf("HungarianAssignment(%v) costs %v, the cheapest assignment costs %v", cost, got, want)
+		}
+	}
+}
+
+// assignmentCost returns the summed cost of an assignment, checking that it pairs min(rows, cols) rows
+func assignmentCost(cost [][]float64, assignment []int) float64 {
+	total, assigned := 0.0, 0
+	used := make(map[int]bool)
+	for i, j := range assignment {
+		if j < 0 {
+			continue
+		}
+		if used[j] {
+			return math.Inf(1)
+		}
+		used[j] = true
+		total += cost[i][j]
+		assigned++
+	}
+	if assigned != minInt(len(cost), len(cost[0])) {
+		return math.Inf(1)
+	}
+	return total
+}
+
+// bruteForceAssignment returns the cheapest cost of assigning rows from row on to the unused columns
+func bruteForceAssignment(cost [][]float64, row int, used []bool) float64 {
+	free := 0
+	for _, u := range used {
+		if !u {
+			free++
+		}
+	}
+	if row == len(cost) || free == 0 {
+		return 0
+	}
+	best := math.Inf(1)
+	// a row may stay unassigned only when there are more remaining rows than free columns
+	if len(cost)-row > free {
+		best = bruteForceAssignment(cost, row+1, used)
+	}
+	for j := range used {
+		if used[j] {
+			continue
+		}
+		used[j] = true
+		best = math.Min(best, cost[row][j]+bruteForceAssignment(cost, row+1, used))
+		used[j] = false
+	}
+	return best
+}
+
+func TestPairChainsPermutedComplex(t *testing.T) {
+	if err := ReadBLOSUM62(); err != nil {
+		t.Fatal(err)
+	}
+	// structure 2 lists the chains in another order and has a chain without a partner in structure 1
+	atoms1 := joinChains(t, [2]string{"A", "1mbn"}, [2]string{"B", "1lyz"})
+	atoms2 := joinChains(t, [2]string{"B", "1lyz"}, [2]string{"C", "1cll"}, [2]string{"A", "1mbn"})
+
+	pairs := PairChains(atoms1, atoms2, 2)
+	if len(pairs) != 2 {
+		t.Fatalf("PairChains returned %d pairs, want 2", len(pairs))
+	}
+	for _, pair := range pairs {
+		if pair.Chain1.id != pair.Chain2.id {
+			t.Errorf("PairChains paired chain %s with chain %s", pair.Chain1.id, pair.Chain2.id)
+		}
+	}
+
+	correspondences := ComplexCorrespondences(pairs)
+	align1, align2 := ComplexAlignment(pairs)
+	if len(correspondences) != len(align1) {
+		t.Fatalf("ComplexCorrespondences returned %d columns, the alignment has %d", len(correspondences), len(align1))
+	}
+	aligned := 0
+	for k, c := range correspondences {
+		if c.Column != k {
+			t.Fatalf("correspondence %d has column %d", k, c.Column)
+		}
+		if c.Res1 == nil || c.Res2 == nil {
+			continue
+		}
+		aligned++
+		if c.Res1.chain != c.Res2.chain || c.Res1.resSeq != c.Res2.resSeq || c.Res1.amino != c.Res2.amino {
+			t.Errorf("column %d pairs %s %s%d with %s %s%d", k, c.Res1.chain, c.Res1.amino, c.Res1.resSeq, c.Res2.chain, c.Res2.amino, c.Res2.resSeq)
+		}
+	}
+	if want := len(Residues(atoms1)); aligned != want {
+		t.Errorf("ComplexCorrespondences aligned %d residues, want all %d of structure 1", aligned, want)
+	}
+
+	sequence1, sequence2 := ComplexSequences(pairs)
+	stats := AlignmentStatistics(sequence1, sequence2, align1, align2)
+	if stats.IdentityShorter != 100 || stats.Coverage1 != 100 || stats.Coverage2 != 100 {
+		t.Errorf("AlignmentStatistics of the paired chains = %.2f%% identity, %.2f%% and %.2f%% coverage, want 100%%",
+			stats.IdentityShorter, stats.Coverage1, stats.Coverage2)
+	}
+}
+
+func TestValidateChainMode(t *testing.T) {
+	tests := []struct {
+		alignFile                            string
+		structural, ssMode, chainMode, dockQ bool
+		valid                                bool
+	}{
+		{"", false, false, false, false, true},
+		{"", false, false, true, true, true},
+		{"pair.fasta", false, false, false, false, true},
+		{"", true, false, false, false, true},
+		{"", false, false, true, false, true},
+		{"", false, true, true, false, false},
+		{"", true, false, true, false, false},
+		{"pair.fasta", false, false, true, true, false},
+		{"", false, false, false, true, false},
+		{"", true, false, false, true, false},
+	}
+	for _, test := range tests {
+		err := ValidateChainMode(test.alignFile, test.structural, test.ssMode, test.chainMode, test.dockQ)
+		if (err == nil) != test.valid {
+			t.Errorf("ValidateChainMode(%q, structural %v, ss %v, chains %v, dockq %v) = %v, want valid %v",
+				test.alignFile, test.structural, test.ssMode, test.chainMode, test.dockQ, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+)
+
+// layout of the heatmap images in pixels
+const (
+	heatmapSize     = 800 // target edge length of the matrix area
+	heatmapMargin   = 50  // room for the residue number ticks left of and below the matrix
+	heatmapBarWidth = 20  // width of the color scale right of the matrix
+	heatmapFont     = 2   // scale of the 3x5 pixel digits
+)
+
+// ResidueMap is a residue by residue matrix of alpha carbon distances, labelled by the atom of every row and
+// column; with Partners set every entry is the distance in Atoms minus the distance between the partners
+// rows are computed on demand, one at a time, so the full matrix is never held in memory
+type ResidueMap struct {
+	Atoms    []*Atom
+	Partners []*Atom
+}
+
+// RunContactMaps writes the alpha carbon distance maps of both structures and the difference map of the aligned
+// residues (structure 1 minus structure 2) as CSV, NPY and PNG files named contact_map1, contact_map2 and
+// contact_difference
+func RunContactMaps(atoms1, atoms2 []*Atom, correspondences []ResidueCorrespondence) {
+	maps := []struct {
+		name      string
+		m         ResidueMap
+		diverging bool
+	}{
+		{"contact_map1", ContactMap(atoms1), false},
+		{"contact_map2", ContactMap(atoms2), false},
+		{"contact_difference", DifferenceMap(correspondences), true},
+	}
+	for _, entry := range maps {
+		if err := entry.m.Save(entry.name, entry.diverging); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Wrote %s.csv, %s.npy and %s.png (%d residues)\n", entry.name, entry.name, entry.name, len(entry.m.Atoms))
+	}
+	fmt.Println()
+}
+
+// ContactMap returns the distances between the alpha carbons of every pair of residues of a structure
+func ContactMap(atoms []*Atom) ResidueMap {
+	return ResidueMap{Atoms: AlphaCarbons(atoms)}
+}
+
+// DifferenceMap returns the alpha carbon distance of every pair of aligned residues in structure 1 minus the
+// distance of their partners in structure 2, labelled by the residues of structure 1
+func DifferenceMap(correspondences []ResidueCorrespondence) ResidueMap {
+	ca1, ca2 := PairAtomSet(correspondences, "ca")
+	return ResidueMap{Atoms: ca1, Partners: ca2}
+}
+
+// Row returns row i of the map
+func (m ResidueMap) Row(i int) []float64 {
+	row := make([]float64, len(m.Atoms))
+	for j := range row {
+		row[j] = Distance(m.Atoms[i], m.Atoms[j])
+		if m.Partners != nil {
+			row[j] -= Distance(m.Partners[i], m.Partners[j])
+		}
+	}
+	return row
+}
+
+// Labels returns the chain and residue number of every row of the map, such as A45 or B102A
+func (m ResidueMap) Labels() []string {
+	labels := make([]string, len(m.Atoms))
+	for i, atom := range m.Atoms {
+		labels[i] = atom.chain + strconv.Itoa(atom.resSeq) + atom.iCode
+	}
+	return labels
+}
+
+// Save writes the map to name.csv, name.npy and name.png; diverging maps are colored symmetrically around zero
+func (m ResidueMap) Save(name string, diverging bool) error {
+	n := len(m.Atoms)
+	writers := map[string]func(w io.Writer) error{
+		".csv": func(w io.Writer) error { return WriteMatrixCSV(w, m.Labels(), m.Row) },
+		".npy": func(w io.Writer) error { return WriteNPY(w, n, n, m.Row) },
+		".png": func(w io.Writer) error { return png.Encode(w, m.Heatmap(diverging)) },
+	}
+	for extension, write := range writers {
+		if err := writeFile(name+extension, write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile creates path and fills it through a buffered writer
+func writeFile(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	if err := write(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// FormatNPY encodes a matrix as a version 1.0 NumPy array of little endian float64 values
+func FormatNPY(values [][]float64) []byte {
+	cols := 0
+	if len(values) > 0 {
+		cols = len(values[0])
+	}
+	var buf bytes.Buffer
+	WriteNPY(&buf, len(values), cols, func(i int) []float64 { return values[i] })
+	return buf.Bytes()
+}
+
+// WriteNPY writes a rows by cols matrix produced one row at a time as a version 1.0 NumPy array of little endian
+// float64 values
+func WriteNPY(w io.Writer, rows, cols int, row func(i int) []float64) error {
+	header := fmt.Sprintf("{'descr': '<f8', 'fortran_order': False, 'shape': (%d, %d), }", rows, cols)
+	// the magic string, version and header length take 10 bytes and the header ends in a newline
+	// padded so that the data starts at a multiple of 64 bytes
+	padding := 64 - (10+len(header)+1)%64
+	if padding == 64 {
+		padding = 0
+	}
+	header += string(bytes.Repeat([]byte{' '}, padding)) + "\n"
+
+	if _, err := io.WriteString(w, "\x93NUMPY\x01\x00"); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint16(len(header))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	for i := 0; i < rows; i++ {
+		if err := binary.Write(w, binary.LittleEndian, row(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Heatmap draws the map with residue number ticks every ten residues (or more for large maps), lines at the
+// chain boundaries and a color scale labelled with its range
+// distances run from black through red and yellow to white; diverging maps run from blue (negative) through
+// white to red (positive)
+func (m ResidueMap) Heatmap(diverging bool) image.Image {
+	n := len(m.Atoms)
+	cell := maxInt(1, heatmapSize/maxInt(1, n))
+	side := n * cell
+	width := heatmapMargin + side + 2*heatmapBarWidth + 6*4*heatmapFont
+	height := side + heatmapMargin + 10
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	fill(img, image.Rect(0, 0, width, height), color.White)
+
+	low, high := 0.0, 0.0
+	for i := 0; i < n; i++ {
+		for _, v := range m.Row(i) {
+			low, high = math.Min(low, v), math.Max(high, v)
+		}
+	}
+	if diverging {
+		high = math.Max(-low, high)
+		low = -high
+	}
+	scale := func(v float64) color.Color {
+		// a map of one value, such as the difference of identical structures, sits in the middle of the scale
+		f := 0.5
+		if high > low {
+			f = (v - low) / (high - low)
+		}
+		if diverging {
+			return toRGBA(RMSFColor(f, 1))
+		}
+		return toRGBA(heatColor(f))
+	}
+
+	// matrix with row 0 at the top, as in the CSV
+	top := 10
+	for i := 0; i < n; i++ {
+		for j, v := range m.Row(i) {
+			fill(img, image.Rect(heatmapMargin+j*cell, top+i*cell, heatmapMargin+(j+1)*cell, top+(i+1)*cell), scale(v))
+		}
+	}
+
+	// chain boundaries
+	black := color.Black
+	for i := 1; i < n; i++ {
+		if m.Atoms[i].chain != m.Atoms[i-1].chain {
+			fill(img, image.Rect(heatmapMargin+i*cell, top, heatmapMargin+i*cell+1, top+side), black)
+			fill(img, image.Rect(heatmapMargin, top+i*cell, heatmapMargin+side, top+i*cell+1), black)
+		}
+	}
+
+	// residue number ticks, at least 5 digit widths apart
+	glyphWidth := 4 * heatmapFont
+	every := 10
+	for every*cell < 5*glyphWidth {
+		every *= 2
+	}
+	for i := 0; i < n; i += every {
+		label := strconv.Itoa(m.Atoms[i].resSeq)
+		x := heatmapMargin + i*cell + cell/2
+		fill(img, image.Rect(x, top+side, x+1, top+side+4), black)
+		drawDigits(img, label, x-len(label)*glyphWidth/2, top+side+6)
+		y := top + i*cell + cell/2
+		fill(img, image.Rect(heatmapMargin-4, y, heatmapMargin, y+1), black)
+		drawDigits(img, label, heatmapMargin-6-len(label)*glyphWidth, y-5*heatmapFont/2)
+	}
+
+	// color scale from high at the top to low at the bottom
+	barLeft := heatmapMargin + side + heatmapBarWidth/2
+	for y := 0; y < side; y++ {
+		v := high - (high-low)*float64(y)/float64(maxInt(1, side-1))
+		fill(img, image.Rect(barLeft, top+y, barLeft+heatmapBarWidth, top+y+1), scale(v))
+	}
+	drawDigits(img, strconv.FormatFloat(high, 'f', 1, 64), barLeft+heatmapBarWidth+4, top)
+	drawDigits(img, strconv.FormatFloat(low, 'f', 1, 64), barLeft+heatmapBarWidth+4, top+side-5*heatmapFont)
+	return img
+}
+
+// heatColor maps a fraction from 0 to 1 onto black, red, yellow and white
+func heatColor(f float64) vec3 {
+	f = math.Max(0, math.Min(1, f))
+	return vec3{math.Min(1, 3*f), math.Max(0, math.Min(1, 3*f-1)), math.Max(0, 3*f-2)}
+}
+
+// toRGBA converts a color with components from 0 to 1
+func toRGBA(c vec3) color.RGBA {
+	return color.RGBA{uint8(255 * c.x), uint8(255 * c.y), uint8(255 * c.z), 255}
+}
+
+// fill paints a rectangle of the image in one color
+func fill(img *image.RGBA, rect image.Rectangle, c color.Color) {
+	rect = rect.Intersect(img.Bounds())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			img.Set(x, y, c)
+		}
+	}
+}
+
+// digitGlyphs are 3x5 pixel bitmaps of the characters used in tick labels, one row of three bits per line
+var digitGlyphs = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	'-': {0, 0, 7, 0, 0},
+	'.': {0, 0, 0, 0, 2},
+}
+
+// drawDigits writes a number in black with its top left corner at x, y
+func drawDigits(img *image.RGBA, text string, x, y int) {
+	for _, r := range text {
+		glyph := digitGlyphs[r]
+		for row, bits := range glyph {
+			for col := 0; col < 3; col++ {
+				if bits&(4>>col) != 0 {
+					px, py := x+col*heatmapFont, y+row*heatmapFont
+					fill(img, image.Rect(px, py, px+heatmapFont, py+heatmapFont), color.Black)
+				}
+			}
+		}
+		x += 4 * heatmapFont
+	}
+}
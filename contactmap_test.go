@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestFormatNPY(t *testing.T) {
+	for _, shape := range [][2]int{{0, 0}, {1, 1}, {2, 3}, {153, 153}, {1000, 12}} {
+		values := make([][]float64, shape[0])
+		for i := range values {
+			values[i] = make([]float64, shape[1])
+			for j := range values[i] {
+				values[i][j] = float64(i) - float64(j)/7
+			}
+		}
+		data := FormatNPY(values)
+		if !bytes.HasPrefix(data, []byte("\x93NUMPY\x01\x00")) {
+			t.Fatalf("FormatNPY %v starts with %q", shape, data[:8])
+		}
+		headerLength := int(binary.LittleEndian.Uint16(data[8:10]))
+		header := string(data[10 : 10+headerLength])
+		if (10+headerLength)%64 != 0 || header[len(header)-1] != '\n' {
+			t.Errorf("FormatNPY %v header of %d bytes is not padded to 64 bytes and ended by a newline", shape, headerLength)
+		}
+		if want := fmt.Sprintf("'shape': (%d, %d)", shape[0], shape[1]); !bytes.Contains([]byte(header), []byte(want)) {
+			t.Errorf("FormatNPY header %q does not contain %s", header, want)
+		}
+		body := data[10+headerLength:]
+		if len(body) != 8*shape[0]*shape[1] {
+			t.Fatalf("FormatNPY %v has %d data bytes, want %d", shape, len(body), 8*shape[0]*shape[1])
+		}
+		for i := range values {
+			for j := range values[i] {
+				offset := 8 * (i*shape[1] + j)
+				if got := math.Float64frombits(binary.LittleEndian.Uint64(body[offset:])); got != values[i][j] {
+					t.Fatalf("FormatNPY %v entry %d,%d reads back as %v, want %v", shape, i, j, got, values[i][j])
+				}
+			}
+		}
+	}
+}
+
+func TestContactMap(t *testing.T) {
+	atoms := ParsePDB("pdbfiles/1mbn.pdb")
+	m := ContactMap(atoms)
+	ca := AlphaCarbons(atoms)
+	for i := range ca {
+		row := m.Row(i)
+		for j := range ca {
+			if want := Distance(ca[i], ca[j]); row[j] != want {
+				t.Fatalf("ContactMap entry %d,%d = %v, want %v", i, j, row[j], want)
+			}
+		}
+	}
+}
+
+func TestDifferenceMap(t *testing.T) {
+	reference := ParsePDB("pdbfiles/1mbn.pdb")
+	// structure 2 is structure 1 scaled about the origin, so every distance grows or shrinks by the same factor
+	for _, factor := range []float64{1.1, 0.9} {
+		scaled := Transform{Rotation: [3][3]float64{{factor, 0, 0}, {0, factor, 0}, {0, 0, factor}}}.ApplyToAtoms(reference)
+		m := DifferenceMap(identicalCorrespondences(reference, scaled))
+		for i := range m.Atoms {
+			for j, v := range m.Row(i) {
+				want := (1 - factor) * Distance(m.Atoms[i], m.Atoms[j])
+				if math.Abs(v-want) > 1e-9 || (i != j && math.Signbit(v) != (factor > 1)) {
+					t.Fatalf("DifferenceMap entry %d,%d of a copy scaled by %v = %v, want %v", i, j, factor, v, want)
+				}
+			}
+		}
+	}
+
+	// a distance change between residues far apart, such as a domain motion, is kept in full
+	moved := IdentityTransform().ApplyToAtoms(reference)
+	last := Residues(moved)[len(Residues(moved))-1]
+	for _, atom := range last.atoms {
+		atom.x += 20
+	}
+	m := DifferenceMap(identicalCorrespondences(reference, moved))
+	first, end := m.Row(0), len(m.Atoms)-1
+	if want := Distance(m.Atoms[0], m.Atoms[end]) - Distance(m.Partners[0], m.Partners[end]); first[end] != want || math.Abs(want) < 1 {
+		t.Errorf("DifferenceMap entry 0,%d = %v, want %v", end, first[end], want)
+	}
+}
+
+func TestHeatmapOfUniformMap(t *testing.T) {
+	// the difference of a structure with itself is zero everywhere, so the whole matrix takes the middle color
+	atoms := ParsePDB("pdbfiles/1mbn.pdb")
+	m := DifferenceMap(identicalCorrespondences(atoms, atoms))
+	want := toRGBA(RMSFColor(0.5, 1))
+	if got := m.Heatmap(true).At(heatmapMargin+1, 11); got != want {
+		t.Errorf("Heatmap of a uniform difference map colors it %v, want %v", got, want)
+	}
+	single := ResidueMap{Atoms: AlphaCarbons(atoms)[:1]}
+	if got, want := single.Heatmap(false).At(heatmapMargin+1, 11), toRGBA(heatColor(0.5)); got != want {
+		t.Errorf("Heatmap of a one residue distance map colors it %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// parameters of core superposition
+const (
+	coreMaxIterations = 50  // maximum number of fit and reject rounds
+	coreMinThreshold  = 0.5 // smallest sigma based threshold in angstroms, so a near perfect core does not shrink on rounding noise
+)
+
+// CoreFit is the result of an iterative superposition that rejects outlying pairs
+type CoreFit struct {
+	Superposition Superposition // fit of the core pairs, with deviations of all pairs under the core transform
+	Core          []int         // indices of the pairs in the final core
+	CoreRMSD      float64       // RMSD of the core pairs under the core transform
+	AllRMSD       float64       // RMSD of all pairs under the core transform
+	Iterations    int
+	Converged     bool
+}
+
+// CoreSuperpose repeatedly superposes the core pairs of two paired atom slices and rebuilds the core from the
+// pairs whose deviation is within a threshold, until the core stops changing
+// the threshold is cutoff angstroms when cutoff > 0, otherwise sigma times the RMSD of the current core
+// (at least coreMinThreshold)
+// weights may be nil for uniform weights
+func CoreSuperpose(fixed, mobile []*Atom, weights []float64, cutoff, sigma float64) CoreFit {
+	n := len(fixed)
+	if weights == nil {
+		weights = make([]float64, n)
+		for i := range weights {
+			weights[i] = 1.0
+		}
+	}
+	core := make([]int, n)
+	for i := range core {
+		core[i] = i
+	}
+
+	var fit CoreFit
+	for iteration := 1; iteration <= coreMaxIterations; iteration++ {
+		fit.Iterations = iteration
+		coreFit := SuperposeAtoms(selectAtoms(fixed, core), selectAtoms(mobile, core), selectWeights(weights, core))
+
+		// deviations of every pair under the core transform
+		all := SuperposeAtomsWith(fixed, mobile, weights, coreFit.Transform)
+		fit.Superposition = all
+		fit.Core = core
+		fit.CoreRMSD = coreFit.RMSD
+		fit.AllRMSD = all.RMSD
+
+		threshold := cutoff
+		if threshold <= 0 {
+			threshold = math.Max(sigma*coreFit.RMSD, coreMinThreshold)
+		}
+		next := make([]int, 0, n)
+		for i, d := range all.Deviations {
+			if d <= threshold {
+				next = append(next, i)
+			}
+		}
+		// keep enough pairs to define a superposition
+		if len(next) < 3 || sameIndices(next, core) {
+			fit.Converged = sameIndices(next, core)
+			break
+		}
+		core = next
+	}
+	return fit
+}
+
+// SuperposeAtomsWith returns the deviations and weighted RMSD of paired atoms under a given transform
+// instead of the best fitting one
+func SuperposeAtomsWith(fixed, mobile []*Atom, weights []float64, t Transform) Superposition {
+	result := Superposition{Transform: t, Deviations: make([]float64, len(fixed)), Weights: weights}
+	sum, total := 0.0, 0.0
+	for i := range fixed {
+		d := vec3{fixed[i].x, fixed[i].y, fixed[i].z}.Subtract(t.Apply(vec3{mobile[i].x, mobile[i].y, mobile[i].z})).Length()
+		result.Deviations[i] = d
+		sum += weights[i] * d * d
+		total += weights[i]
+	}
+	if total > 0 {
+		result.RMSD = math.Sqrt(sum / total)
+	}
+	return result
+}
+
+// PrintCoreFit prints the core size, core RMSD and all-pairs RMSD of a core superposition
+func PrintCoreFit(fit CoreFit) {
+	status := "converged"
+	if !fit.Converged {
+		status = "did not converge"
+	}
+	fmt.Printf("Core superposition %s after %d iterations\n", status, fit.Iterations)
+	fmt.Printf("Core size: %d of %d pairs\n", len(fit.Core), len(fit.Superposition.Deviations))
+	fmt.Printf("Core RMSD: %.3f, all-pairs RMSD under the core transform: %.3f\n", fit.CoreRMSD, fit.AllRMSD)
+	PrintTransform(fit.Superposition.Transform)
+}
+
+// selectAtoms returns the atoms at the given indices
+func selectAtoms(atoms []*Atom, indices []int) []*Atom {
+	selected := make([]*Atom, len(indices))
+	for k, i := range indices {
+		selected[k] = atoms[i]
+	}
+	return selected
+}
+
+// selectWeights returns the weights at the given indices
+func selectWeights(weights []float64, indices []int) []float64 {
+	selected := make([]float64, len(indices))
+	for k, i := range indices {
+		selected[k] = weights[i]
+	}
+	return selected
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCoreSuperpose(t *testing.T) {
+	fixed := AlphaCarbons(ParsePDB("pdbfiles/1mbn.pdb"))
+	// a rotated and shifted copy with a few pairs moved far from the rigid rest
+	motion := Transform{Rotation: [3][3]float64{{0, -1, 0}, {1, 0, 0}, {0, 0, 1}}, Translation: vec3{5, -3, 8}}
+	mobile := motion.ApplyToAtoms(fixed)
+	outliers := []int{10, 50, 100}
+	for _, i := range outliers {
+		mobile[i].z += 15
+	}
+	want := []int{}
+	for i := range fixed {
+		if i != outliers[0] && i != outliers[1] && i != outliers[2] {
+			want = append(want, i)
+		}
+	}
+	wantAll := math.Sqrt(float64(len(outliers)) * 15 * 15 / float64(len(fixed)))
+
+	tests := []struct {
+		cutoff, sigma float64
+	}{
+		{3, 0},
+		{0, 2},
+	}
+	for _, test := range tests {
+		fit := CoreSuperpose(fixed, mobile, nil, test.cutoff, test.sigma)
+		if !sameIndices(fit.Core, want) {
+			t.Errorf("CoreSuperpose(cutoff %v, sigma %v) core = %v, want all pairs but %v", test.cutoff, test.sigma, fit.Core, outliers)
+		}
+		if !fit.Converged {
+			t.Errorf("CoreSuperpose(cutoff %v, sigma %v) did not converge", test.cutoff, test.sigma)
+		}
+		if fit.CoreRMSD > 1e-6 {
+			t.Errorf("CoreSuperpose(cutoff %v, sigma %v) core RMSD = %v, want 0", test.cutoff, test.sigma, fit.CoreRMSD)
+		}
+		// the core transform undoes the rigid motion, so only the outliers deviate, each by 15 angstroms
+		if math.Abs(fit.AllRMSD-wantAll) > 1e-6 {
+			t.Errorf("CoreSuperpose(cutoff %v, sigma %v) all-pairs RMSD = %v, want %v", test.cutoff, test.sigma, fit.AllRMSD, wantAll)
+		}
+		for _, i := range outliers {
+			if d := fit.Superposition.Deviations[i]; math.Abs(d-15) > 1e-6 {
+				t.Errorf("CoreSuperpose(cutoff %v, sigma %v) deviation of pair %d = %v, want 15", test.cutoff, test.sigma, i, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ResidueCorrespondence links one alignment column to the residue it holds in each structure
+// a nil residue marks a gap in that structure
+type ResidueCorrespondence struct {
+	Column     int // 0-based alignment column
+	Res1, Res2 *Residue
+}
+
+// correspondenceRecord is the exported form of a ResidueCorrespondence used for TSV and JSON output
+type correspondenceRecord struct {
+	Column  int    `json:"column"`
+	Chain1  string `json:"chain1,omitempty"`
+	Amino1  string `json:"resName1,omitempty"`
+	ResSeq1 *int   `json:"resSeq1,omitempty"`
+	ICode1  string `json:"iCode1,omitempty"`
+	Chain2  string `json:"chain2,omitempty"`
+	Amino2  string `json:"resName2,omitempty"`
+	ResSeq2 *int   `json:"resSeq2,omitempty"`
+	ICode2  string `json:"iCode2,omitempty"`
+}
+
+// ResidueCorrespondences takes as input two aligned sequences and the residues of both structures
+// (in the order given by Residues) and returns one correspondence per alignment column
+func ResidueCorrespondences(align1, align2 string, residues1, residues2 []Residue) []ResidueCorrespondence {
+	correspondences := make([]ResidueCorrespondence, len(align1))
+	index1, index2 := 0, 0
+	for i := 0; i < len(align1); i++ {
+		correspondences[i].Column = i
+		if align1[i] != '-' && index1 < len(residues1) {
+			correspondences[i].Res1 = &residues1[index1]
+		}
+		if align2[i] != '-' && index2 < len(residues2) {
+			correspondences[i].Res2 = &residues2[index2]
+		}
+		if align1[i] != '-' {
+			index1++
+		}
+		if align2[i] != '-' {
+			index2++
+		}
+	}
+	return correspondences
+}
+
+// AlignedResiduePairs returns only the correspondences where both structures have a residue
+func AlignedResiduePairs(correspondences []ResidueCorrespondence) []ResidueCorrespondence {
+	pairs := make([]ResidueCorrespondence, 0, len(correspondences))
+	for _, c := range correspondences {
+		if c.Res1 != nil && c.Res2 != nil {
+			pairs = append(pairs, c)
+		}
+	}
+	return pairs
+}
+
+// SaveCorrespondences writes the residue correspondence table to path, as JSON if the path ends in .json
+// and as tab separated values otherwise
+func SaveCorrespondences(path, name1, name2 string, correspondences []ResidueCorrespondence) error {
+	var text string
+	if strings.HasSuffix(path, ".json") {
+		data, err := json.MarshalIndent(correspondenceRecords(correspondences), "", "  ")
+		if err != nil {
+			return err
+		}
+		text = string(data) + "\n"
+	} else {
+		text = CorrespondenceTSV(name1, name2, correspondences)
+	}
+	return os.WriteFile(path, []byte(text), 0644)
+}
+
+// CorrespondenceTSV returns the residue correspondence table as tab separated values with one line per
+// alignment column, leaving the fields of a structure empty where it has a gap
+func CorrespondenceTSV(name1, name2 string, correspondences []ResidueCorrespondence) string {
+	var sb strings.Builder
+	sb.WriteString("column")
+	for _, name := range []string{name1, name2} {
+		sb.WriteString(fmt.Sprintf("\t%s_chain\t%s_resName\t%s_resSeq\t%s_iCode", name, name, name, name))
+	}
+	sb.WriteString("\n")
+	for _, c := range correspondences {
+		sb.WriteString(fmt.Sprint(c.Column + 1))
+		for _, res := range []*Residue{c.Res1, c.Res2} {
+			if res == nil {
+				sb.WriteString("\t\t\t\t")
+			} else {
+				sb.WriteString(fmt.Sprintf("\t%s\t%s\t%d\t%s", res.chain, res.amino, res.resSeq, res.iCode))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// correspondenceRecords converts correspondences to records with 1-based columns for export
+func correspondenceRecords(correspondences []ResidueCorrespondence) []correspondenceRecord {
+	records := make([]correspondenceRecord, len(correspondences))
+	for i, c := range correspondences {
+		records[i].Column = c.Column + 1
+		if c.Res1 != nil {
+			resSeq := c.Res1.resSeq
+			records[i].Chain1, records[i].Amino1, records[i].ResSeq1, records[i].ICode1 = c.Res1.chain, c.Res1.amino, &resSeq, c.Res1.iCode
+		}
+		if c.Res2 != nil {
+			resSeq := c.Res2.resSeq
+			records[i].Chain2, records[i].Amino2, records[i].ResSeq2, records[i].ICode2 = c.Res2.chain, c.Res2.amino, &resSeq, c.Res2.iCode
+		}
+	}
+	return records
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// correspondenceFixture returns a gapped alignment of two structures where the second numbers an inserted
+// residue with an insertion code
+func correspondenceFixture() (string, string, []Residue, []Residue) {
+	residues1 := []Residue{
+		{amino: "ALA", chain: "A", seqIndex: 0, resSeq: 1},
+		{amino: "CYS", chain: "A", seqIndex: 1, resSeq: 2},
+		{amino: "ASP", chain: "A", seqIndex: 2, resSeq: 3},
+		{amino: "GLU", chain: "A", seqIndex: 3, resSeq: 4},
+	}
+	residues2 := []Residue{
+		{amino: "CYS", chain: "B", seqIndex: 0, resSeq: 10},
+		{amino: "LYS", chain: "B", seqIndex: 1, resSeq: 10, iCode: "A"},
+		{amino: "ASP", chain: "B", seqIndex: 2, resSeq: 11},
+	}
+	return "AC-DE", "-CKD-", residues1, residues2
+}
+
+func TestResidueCorrespondences(t *testing.T) {
+	align1, align2, residues1, residues2 := correspondenceFixture()
+	correspondences := ResidueCorrespondences(align1, align2, residues1, residues2)
+	// the sequence index of the residue each structure holds in every column, -1 for a gap
+	want := [][2]int{{0, -1}, {1, 0}, {-1, 1}, {2, 2}, {3, -1}}
+	if len(correspondences) != len(want) {
+		t.Fatalf("ResidueCorrespondences() returned %d columns, want %d", len(correspondences), len(want))
+	}
+	for i, c := range correspondences {
+		if c.Column != i {
+			t.Errorf("column of correspondence %d = %d, want %d", i, c.Column, i)
+		}
+		for s, res := range []*Residue{c.Res1, c.Res2} {
+			got := -1
+			if res != nil {
+				got = res.seqIndex
+			}
+			if got != want[i][s] {
+				t.Errorf("residue of structure %d in column %d = %d, want %d", s+1, i, got, want[i][s])
+			}
+		}
+	}
+	if res := correspondences[2].Res2; res == nil || res.chain != "B" || res.resSeq != 10 || res.iCode != "A" {
+		t.Errorf("inserted residue of column 2 = %+v, want B:10A", res)
+	}
+	if pairs := AlignedResiduePairs(correspondences); len(pairs) != 2 || pairs[0].Column != 1 || pairs[1].Column != 3 {
+		t.Errorf("AlignedResiduePairs() = %+v, want columns 1 and 3", pairs)
+	}
+}
+
+func TestCorrespondenceTSV(t *testing.T) {
+	align1, align2, residues1, residues2 := correspondenceFixture()
+	correspondences := ResidueCorrespondences(align1, align2, residues1, residues2)
+	want := strings.Join([]string{
+		"column\tx_chain\tx_resName\tx_resSeq\tx_iCode\ty_chain\ty_resName\ty_resSeq\ty_iCode",
+		"1\tA\tALA\t1\t\t\t\t\t",
+		"2\tA\tCYS\t2\t\tB\tCYS\t10\t",
+		"3\t\t\t\t\tB\tLYS\t10\tA",
+		"4\tA\tASP\t3\t\tB\tASP\t11\t",
+		"5\tA\tGLU\t4\t\t\t\t\t",
+	}, "\n") + "\n"
+	if got := CorrespondenceTSV("x", "y", correspondences); got != want {
+		t.Errorf("CorrespondenceTSV() =\n%q\nwant\n%q", got, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "correspondences.tsv")
+	if err := SaveCorrespondences(path, "x", "y", correspondences); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != want {
+		t.Errorf("SaveCorrespondences(%q) wrote %q (%v), want %q", path, data, err, want)
+	}
+}
+
+func TestSaveCorrespondencesJSON(t *testing.T) {
+	align1, align2, residues1, residues2 := correspondenceFixture()
+	correspondences := ResidueCorrespondences(align1, align2, residues1, residues2)
+	path := filepath.Join(t.TempDir(), "correspondences.json")
+	if err := SaveCorrespondences(path, "x", "y", correspondences); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []correspondenceRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatalf("SaveCorrespondences(%q) wrote invalid JSON: %v", path, err)
+	}
+	if want := correspondenceRecords(correspondences); !reflect.DeepEqual(records, want) {
+		t.Errorf("SaveCorrespondences(%q) round trip = %+v, want %+v", path, records, want)
+	}
+	// a gap leaves out the fields of that structure, and columns are 1-based
+	third := records[2]
+	if third.Column != 3 || third.ResSeq1 != nil || third.Chain2 != "B" || third.ResSeq2 == nil || *third.ResSeq2 != 10 || third.ICode2 != "A" {
+		t.Errorf("record of column 3 = %+v, want a gap in the first structure and B:LYS10A in the second", third)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// CAPRI and DockQ parameters in angstroms
+const (
+	dockingContactCutoff   = 5.0  // heavy atom distance of two residues in contact across chains
+	dockingInterfaceCutoff = 10.0 // heavy atom distance to the partner chain of an interface residue for iRMSD
+	dockQIRMSDScale        = 1.5
+	dockQLRMSDScale        = 8.5
+)
+
+// DockingScores compares the interface between two chains of a model complex with the same interface in the
+// reference; chains are named as in the reference and the receptor is the chain with more aligned residues
+type DockingScores struct {
+	Receptor, Ligand string
+	NativeContacts   int     // residue pairs in contact in the reference
+	ModelContacts    int     // residue pairs in contact in the model
+	Fnat             float64 // fraction of native contacts found in the model
+	Fnonnat          float64 // fraction of model contacts that are not native
+	IRMSD            float64 // backbone RMSD of the interface residues after superposing them
+	LRMSD            float64 // backbone RMSD of the ligand after superposing the receptor
+	DockQ            float64
+}
+
+// DockingComparison scores every chain pair in contact in structure 1 (the reference) against the aligned residues
+// of structure 2 (the model) with the CAPRI measures and DockQ = (Fnat + 1/(1+(iRMSD/1.5)^2) + 1/(1+(LRMSD/8.5)^2))/3
+func DockingComparison(correspondences []ResidueCorrespondence) []DockingScores {
+	pairs := AlignedResiduePairs(correspondences)
+	reference := residuePairDistances(pairs, false, dockingInterfaceCutoff)
+	model := residuePairDistances(pairs, true, dockingContactCutoff)
+
+	// native contacts grouped by the reference chains of the two residues
+	native := make(map[[2]string][][2]int)
+	keys := [][2]string{}
+	for pair, d := range reference {
+		if d >= dockingContactCutoff {
+			continue
+		}
+		chains := chainKey(pairs, pair)
+		if _, ok := native[chains]; !ok {
+			keys = append(keys, chains)
+		}
+		native[chains] = append(native[chains], pair)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || (keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1])
+	})
+
+	results := make([]DockingScores, 0, len(keys))
+	for _, chains := range keys {
+		scores := DockingScores{NativeContacts: len(native[chains])}
+		found := 0
+		for _, pair := range native[chains] {
+			if _, ok := model[pair]; ok {
+				found++
+			}
+		}
+		nonNative := 0
+		for pair := range model {
+			if chainKey(pairs, pair) != chains {
+				continue
+			}
+			scores.ModelContacts++
+			if d, ok := reference[pair]; !ok || d >= dockingContactCutoff {
+				nonNative++
+			}
+		}
+		scores.Fnat = float64(found) / float64(scores.NativeContacts)
+		if scores.ModelContacts > 0 {
+			scores.Fnonnat = float64(nonNative) / float64(scores.ModelContacts)
+		}
+
+		// interface residues are within the wider cutoff of the partner chain in the reference
+		inInterface := make(map[int]bool)
+		for pair := range reference {
+			if chainKey(pairs, pair) == chains {
+				inInterface[pair[0]], inInterface[pair[1]] = true, true
+			}
+		}
+		interfacePairs, receptor, ligand := []ResidueCorrespondence{}, []ResidueCorrespondence{}, []ResidueCorrespondence{}
+		for k, c := range pairs {
+			if inInterface[k] {
+				interfacePairs = append(interfacePairs, c)
+			}
+			if c.Res1.chain == chains[0] {
+				receptor = append(receptor, c)
+			} else if c.Res1.chain == chains[1] {
+				ligand = append(ligand, c)
+			}
+		}
+		fixed, mobile := PairAtomSet(interfacePairs, "backbone")
+		_, scores.IRMSD = QCPSuperpose(AtomCoordinates(fixed), AtomCoordinates(mobile), nil)
+
+		scores.Receptor, scores.Ligand = chains[0], chains[1]
+		if len(ligand) > len(receptor) {
+			receptor, ligand = ligand, receptor
+			scores.Receptor, scores.Ligand = chains[1], chains[0]
+		}
+		receptor1, receptor2 := PairAtomSet(receptor, "backbone")
+		ligand1, ligand2 := PairAtomSet(ligand, "backbone")
+		t, _ := QCPSuperpose(AtomCoordinates(receptor1), AtomCoordinates(receptor2), nil)
+		scores.LRMSD = CoordinateRMSD(AtomCoordinates(ligand1), AtomCoordinates(ligand2), t)
+
+		scores.DockQ = (scores.Fnat + 1/(1+math.Pow(scores.IRMSD/dockQIRMSDScale, 2)) + 1/(1+math.Pow(scores.LRMSD/dockQLRMSDScale, 2))) / 3
+		results = append(results, scores)
+	}
+	return results
+}
+
+// residuePairDistances returns the closest heavy atom distance of every two aligned residues on different chains
+// of the reference that come closer than cutoff, keyed by their indices in pairs; with model the residues of
+// structure 2 are measured, still grouped by the chains of their reference partners
+func residuePairDistances(pairs []ResidueCorrespondence, model bool, cutoff float64) map[[2]int]float64 {
+	atoms := []*Atom{}
+	owners := []int{}
+	for k, c := range pairs {
+		res := c.Res1
+		if model {
+			res = c.Res2
+		}
+		for _, atom := range res.atoms {
+			atoms = append(atoms, atom)
+			owners = append(owners, k)
+		}
+	}
+	distances := make(map[[2]int]float64)
+	for _, pair := range NewAtomIndex(atoms, cutoff).Pairs(cutoff) {
+		i, j := owners[pair[0]], owners[pair[1]]
+		if pairs[i].Res1.chain == pairs[j].Res1.chain {
+			continue
+		}
+		if i > j {
+			i, j = j, i
+		}
+		d := Distance(atoms[pair[0]], atoms[pair[1]])
+		if d >= cutoff {
+			continue
+		}
+		if old, ok := distances[[2]int{i, j}]; !ok || d < old {
+			distances[[2]int{i, j}] = d
+		}
+	}
+	return distances
+}
+
+// chainKey returns the reference chains of a residue pair in alphabetical order
+func chainKey(pairs []ResidueCorrespondence, pair [2]int) [2]string {
+	a, b := pairs[pair[0]].Res1.chain, pairs[pair[1]].Res1.chain
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// PrintDockingScores prints the CAPRI measures and DockQ of every interface and their mean DockQ
+func PrintDockingScores(results []DockingScores) {
+	fmt.Println("Interface comparison (reference chains receptor-ligand):")
+	total := 0.0
+	for _, s := range results {
+		fmt.Printf("  %s-%s: Fnat %.3f (%d native contacts), Fnonnat %.3f (%d model contacts), iRMSD %.3f, LRMSD %.3f, DockQ %.3f\n",
+			s.Receptor, s.Ligand, s.Fnat, s.NativeContacts, s.Fnonnat, s.ModelContacts, s.IRMSD, s.LRMSD, s.DockQ)
+		total += s.DockQ
+	}
+	if len(results) == 0 {
+		fmt.Println("  no chains in contact in the reference structure")
+	} else {
+		fmt.Printf("  mean DockQ %.3f over %d interfaces\n", total/float64(len(results)), len(results))
+	}
+	fmt.Println()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDockingComparison(t *testing.T) {
+	if err := ReadBLOSUM62(); err != nil {
+		t.Fatal(err)
+	}
+	reference := ParsePDB("pdbfiles/1a3n.pdb")
+
+	// the reference against itself
+	results := DockingComparison(ComplexCorrespondences(PairChains(reference, reference, 2)))
+	if len(results) == 0 {
+		t.Fatal("DockingComparison found no interfaces in 1a3n")
+	}
+	for _, s := range results {
+		if s.Fnat != 1 || s.Fnonnat != 0 || s.IRMSD > 1e-6 || s.LRMSD > 1e-6 || math.Abs(s.DockQ-1) > 1e-9 {
+			t.Errorf("DockingComparison of the %s-%s interface with itself = %+v, want Fnat 1, iRMSD and LRMSD 0, DockQ 1", s.Receptor, s.Ligand, s)
+		}
+	}
+
+	// chain A shifted 4 angstroms as a rigid body moves its partners by as much relative to it
+	model := IdentityTransform().ApplyToAtoms(reference)
+	for _, atom := range model {
+		if atom.chain == "A" {
+			atom.x += 4
+		}
+	}
+	moved := 0
+	for _, s := range DockingComparison(ComplexCorrespondences(PairChains(reference, model, 2))) {
+		if s.Receptor != "A" && s.Ligand != "A" {
+			if math.Abs(s.DockQ-1) > 1e-9 {
+				t.Errorf("DockingComparison of the unmoved %s-%s interface = %+v, want DockQ 1", s.Receptor, s.Ligand, s)
+			}
+			continue
+		}
+		moved++
+		if math.Abs(s.LRMSD-4) > 1e-6 || s.IRMSD <= 0 || s.DockQ >= 1 {
+			t.Errorf("DockingComparison of the shifted %s-%s interface = %+v, want LRMSD 4, iRMSD above 0 and DockQ below 1", s.Receptor, s.Ligand, s)
+		}
+	}
+	if moved == 0 {
+		t.Error("DockingComparison found no interface of chain A")
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// parameters of the DSSP assignment (Kabsch and Sander, 1983)
+const (
+	dsspCoupling      = 27.888 // q1 * q2 * f = 0.42 * 0.20 * 332 kcal/mol
+	dsspMaxHBond      = -0.5   // energies below this in kcal/mol are hydrogen bonds
+	dsspMinEnergy     = -9.9   // lowest energy assigned to a hydrogen bond
+	dsspMinDistance   = 0.5    // atoms closer than this give the lowest energy
+	dsspCADistance    = 9.0    // residues with alpha carbons farther apart are not tested for hydrogen bonds
+	dsspPeptideBond   = 2.5    // longest C-N distance of consecutive residues without a chain break
+	dsspBendAngle     = 70.0   // smallest CA(i-2)-CA(i)-CA(i+2) direction change of a bend in degrees
+	dsspNHBondLength  = 1.0    // N-H distance of the hydrogen placed opposite the previous carbonyl
+	dsspBulgeLong     = 6      // a bulge joins ladders separated by fewer residues than this on one strand
+	dsspBulgeShort    = 3      // and fewer than this on the other
+	dsspBestAcceptors = 2      // every N-H keeps only its strongest hydrogen bonds
+)
+
+// dsspResidue holds the backbone of one residue; hasH is false for proline, the first residue of a chain and
+// residues following a break
+type dsspResidue struct {
+	n, ca, c, o, h vec3
+	complete, hasH bool
+	acceptors      [dsspBestAcceptors]struct {
+		index  int
+		energy float64
+	}
+}
+
+// bridge is a pair of residues in a beta bridge
+type bridge struct {
+	i, j     int
+	parallel bool
+}
+
+// DSSP assigns the secondary structure of every residue (in the order of Residues) from backbone hydrogen bond
+// energies: 'H' alpha helix, 'G' 3-10 helix, 'I' pi helix, 'E' strand, 'B' isolated bridge, 'T' turn, 'S' bend
+// and 'C' otherwise; every model of an ensemble is assigned on its own
+func DSSP(atoms []*Atom) []byte {
+	ss := []byte{}
+	for _, model := range SplitModels(atoms) {
+		ss = append(ss, dsspModel(Residues(model))...)
+	}
+	return ss
+}
+
+// dsspModel assigns the secondary structure of the residues of one model
+func dsspModel(residues []Residue) []byte {
+	n := len(residues)
+	backbone := make([]dsspResidue, n)
+	for k := range residues {
+		res := &residues[k]
+		atoms := []*Atom{residueAtom(res, "N"), residueAtom(res, "CA"), residueAtom(res, "C"), residueAtom(res, "O")}
+		backbone[k].complete = atoms[0] != nil && atoms[1] != nil && atoms[2] != nil && atoms[3] != nil
+		if backbone[k].complete {
+			coords := AtomCoordinates(atoms)
+			backbone[k].n, backbone[k].ca, backbone[k].c, backbone[k].o = coords[0], coords[1], coords[2], coords[3]
+		}
+		for b := range backbone[k].acceptors {
+			backbone[k].acceptors[b].index = -1
+		}
+	}
+	// breaks[k] is true when residues k and k+1 are not joined by a peptide bond
+	breaks := make([]bool, n)
+	for k := 0; k+1 < n; k++ {
+		breaks[k] = residues[k].chain != residues[k+1].chain || !backbone[k].complete || !backbone[k+1].complete ||
+			backbone[k].c.Subtract(backbone[k+1].n).Length() > dsspPeptideBond
+	}
+	for k := 1; k < n; k++ {
+		if !breaks[k-1] && residues[k].amino != "PRO" {
+			// the hydrogen points away from the carbonyl oxygen of the previous residue
+			prev := backbone[k-1]
+			backbone[k].h = backbone[k].n.Add(prev.c.Subtract(prev.o).Normalize().Scale(dsspNHBondLength))
+			backbone[k].hasH = true
+		}
+	}
+	noBreak := func(from, to int) bool {
+		if from < 0 || to >= n {
+			return false
+		}
+		for k := from; k < to; k++ {
+			if breaks[k] {
+				return false
+			}
+		}
+		return true
+	}
+
+	// hydrogen bond energies of every donor against the acceptors nearby
+	alphaCarbons := make([]vec3, n)
+	for k := range backbone {
+		alphaCarbons[k] = backbone[k].ca
+	}
+	index := NewSpatialIndex(alphaCarbons, dsspCADistance)
+	for donor := range backbone {
+		if !backbone[donor].hasH {
+			continue
+		}
+		for _, acceptor := range index.Within(alphaCarbons[donor], dsspCADistance) {
+			if acceptor == donor || acceptor == donor-1 || !backbone[acceptor].complete {
+				continue
+			}
+			recordAcceptor(&backbone[donor], acceptor, hbondEnergy(backbone[donor], backbone[acceptor]))
+		}
+	}
+	// hbond reports a hydrogen bond from the C=O of residue i to the N-H of residue j
+	hbond := func(i, j int) bool {
+		if i < 0 || j < 0 || i >= n || j >= n {
+			return false
+		}
+		for _, a := range backbone[j].acceptors {
+			if a.index == i && a.energy < dsspMaxHBond {
+				return true
+			}
+		}
+		return false
+	}
+	// turn reports an n-turn starting at residue i
+	turn := func(stride, i int) bool {
+		return noBreak(i, i+stride) && hbond(i, i+stride)
+	}
+
+	ss := make([]byte, n)
+	for k := range ss {
+		ss[k] = 'C'
+	}
+
+	// beta bridges, grouped into ladders of consecutive bridges
+	ladders := [][]bridge{}
+	for i := 1; i+4 < n; i++ {
+		for j := i + 3; j+1 < n; j++ {
+			if !noBreak(i-1, i+1) || !noBreak(j-1, j+1) {
+				continue
+			}
+			var b *bridge
+			if (hbond(i-1, j) && hbond(j, i+1)) || (hbond(j-1, i) && hbond(i, j+1)) {
+				b = &bridge{i, j, true}
+			} else if (hbond(i, j) && hbond(j, i)) || (hbond(i-1, j+1) && hbond(j-1, i+1)) {
+				b = &bridge{i, j, false}
+			}
+			if b == nil {
+				continue
+			}
+			extended := false
+			for l, ladder := range ladders {
+				last := ladder[len(ladder)-1]
+				step := 1
+				if !b.parallel {
+					step = -1
+				}
+				if last.parallel == b.parallel && last.i+1 == b.i && last.j+step == b.j {
+					ladders[l] = append(ladders[l], *b)
+					extended = true
+					break
+				}
+			}
+			if !extended {
+				ladders = append(ladders, []bridge{*b})
+			}
+		}
+	}
+	// ladders of the same type separated by a bulge form one strand pair
+	group := make([]int, len(ladders))
+	for l := range group {
+		group[l] = l
+	}
+	root := func(l int) int {
+		for group[l] != l {
+			l = group[l]
+		}
+		return l
+	}
+	for a, first := range ladders {
+		for b, second := range ladders {
+			endA, startB := first[len(first)-1], second[0]
+			if a == b || endA.parallel != startB.parallel || startB.i <= endA.i {
+				continue
+			}
+			gapI := startB.i - endA.i
+			gapJ := startB.j - endA.j
+			if !endA.parallel {
+				gapJ = endA.j - startB.j
+			}
+			if gapJ > 0 && ((gapI < dsspBulgeLong && gapJ < dsspBulgeShort) || (gapI < dsspBulgeShort && gapJ < dsspBulgeLong)) &&
+				noBreak(endA.i, startB.i) && noBreak(minInt(endA.j, startB.j), maxInt(endA.j, startB.j)) {
+				group[root(b)] = root(a)
+			}
+		}
+	}
+	members := make(map[int][]bridge)
+	for l, ladder := range ladders {
+		members[root(l)] = append(members[root(l)], ladder...)
+	}
+	for _, bridges := range members {
+		if len(bridges) == 1 {
+			continue
+		}
+		lowI, highI, lowJ, highJ := n, -1, n, -1
+		for _, b := range bridges {
+			lowI, highI = minInt(lowI, b.i), maxInt(highI, b.i)
+			lowJ, highJ = minInt(lowJ, b.j), maxInt(highJ, b.j)
+		}
+		for k := lowI; k <= highI; k++ {
+			ss[k] = 'E'
+		}
+		for k := lowJ; k <= highJ; k++ {
+			ss[k] = 'E'
+		}
+	}
+	for _, bridges := range members {
+		if len(bridges) == 1 {
+			ss[bridges[0].i], ss[bridges[0].j] = 'B', 'B'
+		}
+	}
+
+	// alpha helices override strands; 3-10 and pi helices only fill residues still without a state
+	for i := 1; i+4 < n; i++ {
+		if turn(4, i-1) && turn(4, i) {
+			for k := i; k < i+4; k++ {
+				ss[k] = 'H'
+			}
+		}
+	}
+	for _, helix := range []struct {
+		stride int
+		state  byte
+	}{{3, 'G'}, {5, 'I'}} {
+		for i := 1; i+helix.stride < n; i++ {
+			if !turn(helix.stride, i-1) || !turn(helix.stride, i) {
+				continue
+			}
+			empty := true
+			for k := i; k < i+helix.stride; k++ {
+				empty = empty && (ss[k] == 'C' || ss[k] == helix.state)
+			}
+			if empty {
+				for k := i; k < i+helix.stride; k++ {
+					ss[k] = helix.state
+				}
+			}
+		}
+	}
+
+	// turns and bends
+	for k := range ss {
+		if ss[k] != 'C' {
+			continue
+		}
+		for stride := 3; stride <= 5 && ss[k] == 'C'; stride++ {
+			for back := 1; back < stride; back++ {
+				if k-back >= 0 && turn(stride, k-back) {
+					ss[k] = 'T'
+					break
+				}
+			}
+		}
+		if ss[k] == 'C' && noBreak(k-2, k+2) {
+			before := backbone[k].ca.Subtract(backbone[k-2].ca)
+			after := backbone[k+2].ca.Subtract(backbone[k].ca)
+			if vectorAngle(before, after) > dsspBendAngle {
+				ss[k] = 'S'
+			}
+		}
+	}
+	return ss
+}
+
+// hbondEnergy returns the electrostatic energy of the hydrogen bond from the N-H of donor to the C=O of acceptor
+func hbondEnergy(donor, acceptor dsspResidue) float64 {
+	rON := acceptor.o.Subtract(donor.n).Length()
+	rCH := acceptor.c.Subtract(donor.h).Length()
+	rOH := acceptor.o.Subtract(donor.h).Length()
+	rCN := acceptor.c.Subtract(donor.n).Length()
+	if rON < dsspMinDistance || rCH < dsspMinDistance || rOH < dsspMinDistance || rCN < dsspMinDistance {
+		return dsspMinEnergy
+	}
+	return math.Max(dsspMinEnergy, dsspCoupling*(1/rON+1/rCH-1/rOH-1/rCN))
+}
+
+// recordAcceptor keeps the acceptor if it is among the strongest hydrogen bonds of the donor
+func recordAcceptor(donor *dsspResidue, acceptor int, energy float64) {
+	for b := range donor.acceptors {
+		if donor.acceptors[b].index < 0 || energy < donor.acceptors[b].energy {
+			copy(donor.acceptors[b+1:], donor.acceptors[b:len(donor.acceptors)-1])
+			donor.acceptors[b].index, donor.acceptors[b].energy = acceptor, energy
+			return
+		}
+	}
+}
+
+// SSComparison holds the secondary structure of two structures laid out along their alignment
+type SSComparison struct {
+	Aligned1, Aligned2 string // states of every alignment column, '-' for gaps
+	Differences        string // '*' where two aligned residues have different states
+	Pairs              int    // aligned residue pairs
+	Identical          float64
+	Identical3         float64 // agreement after reducing to helix (H, G, I), strand (E, B) and coil
+}
+
+// CompareSecondaryStructure lays out the states of both structures (in the order of Residues) along the residue
+// correspondence and measures their agreement over the aligned residue pairs
+func CompareSecondaryStructure(correspondences []ResidueCorrespondence, residues1, residues2 []Residue, ss1, ss2 []byte) SSComparison {
+	state1, state2 := residueStates(residues1, ss1), residueStates(residues2, ss2)
+	var row1, row2, diff strings.Builder
+	result := SSComparison{}
+	same, same3 := 0, 0
+	for _, c := range correspondences {
+		s1, s2 := byte('-'), byte('-')
+		if c.Res1 != nil {
+			s1 = state1[c.Res1.seqIndex]
+		}
+		if c.Res2 != nil {
+			s2 = state2[c.Res2.seqIndex]
+		}
+		row1.WriteByte(s1)
+		row2.WriteByte(s2)
+		if c.Res1 == nil || c.Res2 == nil {
+			diff.WriteByte(' ')
+			continue
+		}
+		result.Pairs++
+		if s1 == s2 {
+			same++
+			diff.WriteByte(' ')
+		} else {
+			diff.WriteByte('*')
+		}
+		if reducedState(s1) == reducedState(s2) {
+			same3++
+		}
+	}
+	result.Aligned1, result.Aligned2, result.Differences = row1.String(), row2.String(), diff.String()
+	if result.Pairs > 0 {
+		result.Identical = 100 * float64(same) / float64(result.Pairs)
+		result.Identical3 = 100 * float64(same3) / float64(result.Pairs)
+	}
+	return result
+}
+
+// residueStates maps the residue index of every residue to its state
+func residueStates(residues []Residue, ss []byte) map[int]byte {
+	states := make(map[int]byte, len(residues))
+	for k, res := range residues {
+		states[res.seqIndex] = ss[k]
+	}
+	return states
+}
+
+// reducedState reduces a DSSP state to helix 'H', strand 'E' or coil 'C'
+func reducedState(state byte) byte {
+	switch state {
+	case 'H', 'G', 'I':
+		return 'H'
+	case 'E', 'B':
+		return 'E'
+	}
+	return 'C'
+}
+
+// PrintSSComparison prints the aligned sequences with their secondary structure and the agreement
+func PrintSSComparison(comparison SSComparison, align1, align2 string) {
+	fmt.Println("Secondary structure (DSSP) along the alignment:")
+	fmt.Println(align1)
+	fmt.Println(comparison.Aligned1)
+	fmt.Println(comparison.Differences)
+	fmt.Println(comparison.Aligned2)
+	fmt.Println(align2)
+	fmt.Printf("Identical states for %.2f%% of %d aligned residue pairs, %.2f%% in three states\n\n", comparison.Identical, comparison.Pairs, comparison.Identical3)
+}
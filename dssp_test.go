@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// placeAtom returns the point at the given bond length from c that makes the angle b-c-d and the dihedral
+// a-b-c-d, both in degrees
+func placeAtom(a, b, c vec3, bond, angle, dihedral float64) vec3 {
+	angle, dihedral = angle*math.Pi/180, dihedral*math.Pi/180
+	bc := c.Subtract(b).Normalize()
+	n := b.Subtract(a).Cross(bc).Normalize()
+	m := n.Cross(bc)
+	return c.Add(bc.Scale(-bond * math.Cos(angle))).Add(m.Scale(bond * math.Sin(angle) * math.Cos(dihedral))).
+		Add(n.Scale(bond * math.Sin(angle) * math.Sin(dihedral)))
+}
+
+// idealBackbone builds the N, CA, C and O atoms of a chain of alanines with ideal bond geometry, trans peptide
+// bonds and the given phi and psi angles of every residue
+func idealBackbone(angles [][2]float64) []*Atom {
+	atoms := []*Atom{}
+	n, ca := vec3{0, 0, 0}, vec3{1.458, 0, 0}
+	c := placeAtom(vec3{0, 1, 0}, n, ca, 1.525, 111.2, -60)
+	for k, phiPsi := range angles {
+		if k > 0 {
+			prevN, prevCA, prevC := n, ca, c
+			n = placeAtom(prevN, prevCA, prevC, 1.329, 116.2, angles[k-1][1])
+			ca = placeAtom(prevCA, prevC, n, 1.458, 121.7, 180)
+			c = placeAtom(prevC, n, ca, 1.525, 111.2, phiPsi[0])
+		}
+		next := placeAtom(n, ca, c, 1.329, 116.2, phiPsi[1])
+		o := placeAtom(next, ca, c, 1.231, 120.5, 180)
+		names := []string{"N", "CA", "C", "O"}
+		for i, p := range []vec3{n, ca, c, o} {
+			atoms = append(atoms, &Atom{element: names[i], amino: "ALA", chain: "A", seqIndex: k, resSeq: k + 1, x: p.x, y: p.y, z: p.z})
+		}
+	}
+	return atoms
+}
+
+// repeatAngles returns count copies of one phi and psi pair
+func repeatAngles(phiPsi [2]float64, count int) [][2]float64 {
+	angles := make([][2]float64, count)
+	for k := range angles {
+		angles[k] = phiPsi
+	}
+	return angles
+}
+
+func TestDSSP(t *testing.T) {
+	strand := repeatAngles([2]float64{-120, 130}, 6)
+	// two residues that turn the chain back so that the strands pair
+	hairpin := append(append(append([][2]float64{}, strand...), [2]float64{-30, 90}, [2]float64{120, -60}), strand...)
+	tests := []struct {
+		name   string
+		angles [][2]float64
+		want   string
+	}{
+		// i -> i+4 hydrogen bonds from the first to the last residue leave only the two ends out of the helix
+		{"an alpha helix", repeatAngles([2]float64{-57, -47}, 20), "CHHHHHHHHHHHHHHHHHHC"},
+		{"a beta hairpin", hairpin, "CEEEEETTEEEEEC"},
+		{"an extended strand", repeatAngles([2]float64{-120, 130}, 8), "CCCCCCCC"},
+	}
+	for _, test := range tests {
+		if got := string(DSSP(idealBackbone(test.angles))); got != test.want {
+			t.Errorf("DSSP of %s = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCompareSecondaryStructure(t *testing.T) {
+	helix := idealBackbone(repeatAngles([2]float64{-57, -47}, 14))
+	strand := repeatAngles([2]float64{-120, 130}, 6)
+	hairpin := idealBackbone(append(append(append([][2]float64{}, strand...), [2]float64{-30, 90}, [2]float64{120, -60}), strand...))
+	ss1, ss2 := DSSP(helix), DSSP(hairpin)
+	comparison := CompareSecondaryStructure(identicalCorrespondences(helix, hairpin), Residues(helix), Residues(hairpin), ss1, ss2)
+	if comparison.Aligned1 != "CHHHHHHHHHHHHC" || comparison.Aligned2 != "CEEEEETTEEEEEC" || comparison.Differences != " ************ " {
+		t.Errorf("CompareSecondaryStructure rows = %q, %q, %q", comparison.Aligned1, comparison.Aligned2, comparison.Differences)
+	}
+	// only the coil at both ends agrees
+	if want := 100 * 2.0 / 14; comparison.Pairs != 14 || math.Abs(comparison.Identical-want) > 1e-9 || math.Abs(comparison.Identical3-want) > 1e-9 {
+		t.Errorf("CompareSecondaryStructure agreement = %.2f%% and %.2f%% over %d pairs, want %.2f%% over 14", comparison.Identical, comparison.Identical3, comparison.Pairs, want)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parameters of iterative superposition onto the ensemble mean
+const (
+	ensembleMaxIterations = 50
+	ensembleTolerance     = 1e-4 // RMSD in angstroms between successive means that counts as converged
+)
+
+// EnsembleAnalysis is the result of superposing the models of an ensemble such as an NMR structure
+type EnsembleAnalysis struct {
+	Models       [][]*Atom   // superposed copies of the atoms common to every model, in the same order
+	Transforms   []Transform // moves every original model onto the reference frame
+	Average      []*Atom     // mean coordinates of the superposed models, with the RMSF of every atom
+	Residues     []Residue   // residues of the average structure
+	ResidueRMSF  []float64   // RMSF of the alpha carbon of every residue (mean over its atoms if it has none)
+	Medoid       int         // model with the smallest summed RMSD to all other models
+	PairwiseRMSD [][]float64 // optimal RMSD between every pair of models
+}
+
+// RunEnsemble superposes the models of a PDB entry onto the reference model, or iteratively onto their mean,
+// prints the RMSF and pairwise RMSD summary and writes the RMSF table, RMSD matrix, average and medoid structures
+func RunEnsemble(pdbID string, reference int, iterative bool) {
+	models := SplitModels(ParsePDB(FetchPDB(pdbID)))
+	if len(models) < 2 {
+		log.Fatalf("%s has %d models, an ensemble needs at least 2", pdbID, len(models))
+	}
+	if reference < 0 || reference >= len(models) {
+		log.Fatalf("reference model %d is out of range 0-%d", reference, len(models)-1)
+	}
+	analysis, err := AnalyzeEnsemble(models, reference, iterative)
+	if err != nil {
+		log.Fatalf("%s: %v", pdbID, err)
+	}
+	PrintEnsemble(analysis)
+
+	names := make([]string, len(models))
+	for i, model := range models {
+		names[i] = "model" + strconv.Itoa(model[0].model)
+	}
+	outputs := map[string]string{
+		"ensemble_rmsf.tsv":    RMSFTable(analysis),
+		"ensemble_rmsd.csv":    MatrixCSV(names, analysis.PairwiseRMSD),
+		"ensemble_average.pdb": FormatPDB(analysis.Average),
+		"ensemble_medoid.pdb":  FormatPDB(analysis.Models[analysis.Medoid]),
+	}
+	for path, text := range outputs {
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// SplitModels groups the atoms of a parsed structure by MODEL record, keeping file order
+// a structure without MODEL records is returned as a single model
+func SplitModels(atoms []*Atom) [][]*Atom {
+	models := [][]*Atom{}
+	for i, atom := range atoms {
+		if i == 0 || atom.model != atoms[i-1].model {
+			models = append(models, []*Atom{})
+		}
+		models[len(models)-1] = append(models[len(models)-1], atom)
+	}
+	return models
+}
+
+// CommonModelAtoms returns, for every model, the atoms present in all models (matched by chain, residue number,
+// insertion code and atom name) in the order of the reference model
+func CommonModelAtoms(models [][]*Atom, reference int) [][]*Atom {
+	lookups := make([]map[string]*Atom, len(models))
+	for m, model := range models {
+		lookups[m] = make(map[string]*Atom, len(model))
+		for _, atom := range model {
+			lookups[m][ensembleAtomKey(atom)] = atom
+		}
+	}
+	common := make([][]*Atom, len(models))
+	for _, atom := range models[reference] {
+		key := ensembleAtomKey(atom)
+		found := true
+		for m := range models {
+			if lookups[m][key] == nil {
+				found = false
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		for m := range models {
+			common[m] = append(common[m], lookups[m][key])
+		}
+	}
+	return common
+}
+
+// AnalyzeEnsemble superposes every model onto the reference model, and with iterative repeatedly onto the mean
+// of the superposed models until the mean stops moving, then computes RMSF, average and medoid structures and the
+// pairwise RMSD of the models; it fails when the models have no atoms in common
+func AnalyzeEnsemble(models [][]*Atom, reference int, iterative bool) (EnsembleAnalysis, error) {
+	common := CommonModelAtoms(models, reference)
+	if len(common[reference]) == 0 {
+		return EnsembleAnalysis{}, fmt.Errorf("the %d models have no atoms in common", len(models))
+	}
+	coords := make([][]vec3, len(common))
+	for m, atoms := range common {
+		coords[m] = AtomCoordinates(atoms)
+	}
+
+	analysis := EnsembleAnalysis{Transforms: make([]Transform, len(common))}
+	target := coords[reference]
+	for iteration := 0; ; iteration++ {
+		for m := range coords {
+			analysis.Transforms[m], _ = QCPSuperpose(target, coords[m], nil)
+		}
+		if !iterative || iteration == ensembleMaxIterations {
+			break
+		}
+		mean := ensembleMean(coords, analysis.Transforms)
+		converged := CoordinateRMSD(target, mean, IdentityTransform()) < ensembleTolerance
+		target = mean
+		if converged {
+			break
+		}
+	}
+
+	analysis.Models = make([][]*Atom, len(common))
+	for m := range common {
+		analysis.Models[m] = analysis.Transforms[m].ApplyToAtoms(common[m])
+	}
+	mean := ensembleMean(coords, analysis.Transforms)
+
+	// the average structure carries the fluctuation of every atom about the mean
+	analysis.Average = IdentityTransform().ApplyToAtoms(common[reference])
+	for i, atom := range analysis.Average {
+		atom.x, atom.y, atom.z = mean[i].x, mean[i].y, mean[i].z
+		sum := 0.0
+		for m := range analysis.Models {
+			moved := analysis.Models[m][i]
+			d := vec3{moved.x, moved.y, moved.z}.Subtract(mean[i])
+			sum += d.Dot(d)
+		}
+		atom.rmsf = math.Sqrt(sum / float64(len(analysis.Models)))
+		atom.bFactor = atom.rmsf
+	}
+	analysis.Residues = Residues(analysis.Average)
+	analysis.ResidueRMSF = make([]float64, len(analysis.Residues))
+	for r, res := range analysis.Residues {
+		analysis.ResidueRMSF[r] = residueRMSF(res)
+	}
+
+	n := len(coords)
+	analysis.PairwiseRMSD = squareMatrix(n)
+	bestSum := math.Inf(1)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			_, rmsd := QCPSuperpose(coords[i], coords[j], nil)
+			analysis.PairwiseRMSD[i][j], analysis.PairwiseRMSD[j][i] = rmsd, rmsd
+		}
+	}
+	for i, row := range analysis.PairwiseRMSD {
+		sum := 0.0
+		for _, rmsd := range row {
+			sum += rmsd
+		}
+		if sum < bestSum {
+			bestSum, analysis.Medoid = sum, i
+		}
+	}
+	return analysis, nil
+}
+
+// AssignRMSF superposes the models of a parsed structure and stores the RMSF of every residue on all of its atoms
+// in every model, returning the largest value; structures with a single model are left untouched
+func AssignRMSF(atoms []*Atom) (float64, error) {
+	models := SplitModels(atoms)
+	if len(models) < 2 {
+		return 0, nil
+	}
+	analysis, err := AnalyzeEnsemble(models, 0, false)
+	if err != nil {
+		return 0, err
+	}
+	rmsf := make(map[string]float64, len(analysis.Residues))
+	for r, res := range analysis.Residues {
+		rmsf[res.chain+":"+strconv.Itoa(res.resSeq)+res.iCode] = analysis.ResidueRMSF[r]
+	}
+	largest := 0.0
+	for _, atom := range atoms {
+		atom.rmsf = rmsf[atom.chain+":"+strconv.Itoa(atom.resSeq)+atom.iCode]
+		largest = math.Max(largest, atom.rmsf)
+	}
+	return largest, nil
+}
+
+// RMSFColor maps an RMSF onto a blue (rigid) to white to red (flexible) scale topped at largest
+func RMSFColor(rmsf, largest float64) vec3 {
+	f := 0.0
+	if largest > 0 {
+		f = math.Min(1, rmsf/largest)
+	}
+	if f < 0.5 {
+		return vec3{2 * f, 2 * f, 1}
+	}
+	return vec3{1, 2 - 2*f, 2 - 2*f}
+}
+
+// PrintEnsemble prints the medoid, the pairwise RMSD distribution and the RMSF of every residue
+func PrintEnsemble(analysis EnsembleAnalysis) {
+	values := []float64{}
+	for i, row := range analysis.PairwiseRMSD {
+		values = append(values, row[i+1:]...)
+	}
+	mean, sd := MeanStdDev(values)
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		low, high = math.Min(low, v), math.Max(high, v)
+	}
+	fmt.Printf("Ensemble of %d models, %d common atoms, medoid model %d\n", len(analysis.Models), len(analysis.Average), analysis.Models[analysis.Medoid][0].model)
+	fmt.Printf("Pairwise RMSD: mean %.3f, sd %.3f, min %.3f, max %.3f over %d pairs\n", mean, sd, low, high, len(values))
+	fmt.Println("Per-residue RMSF:")
+	for r, res := range analysis.Residues {
+		fmt.Printf("  %s %s %d%s %.3f\n", res.chain, res.amino, res.resSeq, res.iCode, analysis.ResidueRMSF[r])
+	}
+	fmt.Println()
+}
+
+// RMSFTable returns the per-residue RMSF as tab separated values
+func RMSFTable(analysis EnsembleAnalysis) string {
+	var sb strings.Builder
+	sb.WriteString("chain\tresName\tresSeq\tiCode\trmsf\n")
+	for r, res := range analysis.Residues {
+		sb.WriteString(fmt.Sprintf("%s\t%s\t%d\t%s\t%.3f\n", res.chain, res.amino, res.resSeq, res.iCode, analysis.ResidueRMSF[r]))
+	}
+	return sb.String()
+}
+
+// ensembleMean returns the mean position of every atom over the models moved by their transforms
+func ensembleMean(coords [][]vec3, transforms []Transform) []vec3 {
+	mean := make([]vec3, len(coords[0]))
+	for m := range coords {
+		for i, p := range coords[m] {
+			mean[i] = mean[i].Add(transforms[m].Apply(p))
+		}
+	}
+	for i := range mean {
+		mean[i] = mean[i].Scale(1 / float64(len(coords)))
+	}
+	return mean
+}
+
+// residueRMSF returns the RMSF of the alpha carbon of a residue, or the mean over its atoms without one
+func residueRMSF(res Residue) float64 {
+	sum := 0.0
+	for _, atom := range res.atoms {
+		if atom.element == "CA" {
+			return atom.rmsf
+		}
+		sum += atom.rmsf
+	}
+	return sum / float64(len(res.atoms))
+}
+
+// ensembleAtomKey identifies an atom across the models of an ensemble
+func ensembleAtomKey(atom *Atom) string {
+	return atom.chain + ":" + strconv.Itoa(atom.resSeq) + atom.iCode + ":" + atom.element
+}
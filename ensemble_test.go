@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAnalyzeEnsemble(t *testing.T) {
+	models := SplitModels(ParsePDB("pdbfiles/1ego.pdb"))
+	if len(models) < 2 {
+		t.Fatalf("1ego has %d models, want an ensemble", len(models))
+	}
+	analysis, err := AnalyzeEnsemble(models, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.Medoid < 0 || analysis.Medoid >= len(models) {
+		t.Errorf("AnalyzeEnsemble medoid = %d, want a model in 0-%d", analysis.Medoid, len(models)-1)
+	}
+	for i, row := range analysis.PairwiseRMSD {
+		if row[i] != 0 {
+			t.Errorf("RMSD of model %d with itself = %v, want 0", i, row[i])
+		}
+	}
+
+	// two identical copies of a model do not fluctuate
+	model := models[0]
+	copied := IdentityTransform().ApplyToAtoms(model)
+	for _, atom := range copied {
+		atom.model++
+	}
+	analysis, err = AnalyzeEnsemble([][]*Atom{model, copied}, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r, rmsf := range analysis.ResidueRMSF {
+		if math.Abs(rmsf) > 1e-6 {
+			t.Errorf("RMSF of residue %d in two identical models = %v, want 0", r, rmsf)
+		}
+	}
+}
+
+func TestAnalyzeEnsembleWithoutCommonAtoms(t *testing.T) {
+	// models of unrelated chains share no atoms and have no medoid
+	atoms := joinChains(t, [2]string{"A", "1mbn"}, [2]string{"B", "1lyz"})
+	models := [][]*Atom{{}, {}}
+	for _, atom := range atoms {
+		if atom.chain == "B" {
+			atom.model = 1
+			models[1] = append(models[1], atom)
+		} else {
+			models[0] = append(models[0], atom)
+		}
+	}
+	if _, err := AnalyzeEnsemble(models, 0, false); err == nil {
+		t.Errorf("AnalyzeEnsemble of models without common atoms returned no error")
+	}
+	if _, err := AssignRMSF(atoms); err == nil {
+		t.Errorf("AssignRMSF of models without common atoms returned no error")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// RigidFragment is a run of consecutive aligned residue pairs superposed by its own transform
+type RigidFragment struct {
+	Start, End int       // indices of the first and last residue pair of the fragment
+	Transform  Transform // moves the structure 2 residues of the fragment onto structure 1
+	RMSD       float64
+}
+
+// FlexibleAlignment splits an alignment into rigid fragments separated by hinges
+type FlexibleAlignment struct {
+	Pairs     []ResidueCorrespondence // aligned residue pairs in alignment order
+	Fragments []RigidFragment
+	Hinges    []ResidueCorrespondence // first residue pair of every fragment after the first
+	RMSD      float64                 // RMSD over all pairs with every fragment under its own transform
+	RigidRMSD float64                 // RMSD over all pairs under a single superposition
+}
+
+// FlexibleSuperpose splits the aligned residue pairs of a correspondence into consecutive fragments of at least
+// minFragment pairs, each superposed separately on its alpha carbons, choosing the split that minimizes the
+// summed squared deviation plus hingePenalty (in square angstroms) for every hinge
+func FlexibleSuperpose(correspondences []ResidueCorrespondence, hingePenalty float64, minFragment int) FlexibleAlignment {
+	pairs := AlignedResiduePairs(correspondences)
+	n := len(pairs)
+	fixed, mobile := make([]vec3, n), make([]vec3, n)
+	for i, c := range pairs {
+		fixed[i] = residueCoordinate(c.Res1)
+		mobile[i] = residueCoordinate(c.Res2)
+	}
+	result := FlexibleAlignment{Pairs: pairs}
+	if n == 0 {
+		return result
+	}
+	if minFragment < 3 {
+		minFragment = 3
+	}
+	_, result.RigidRMSD = QCPSuperpose(fixed, mobile, nil)
+
+	// cost[j] is the best cost of splitting the first j pairs, start[j] where its last fragment begins
+	sums := newFragmentSums(fixed, mobile)
+	cost := make([]float64, n+1)
+	start := make([]int, n+1)
+	for j := 1; j <= n; j++ {
+		cost[j] = math.Inf(1)
+		for i := 0; i < j; i++ {
+			if j-i < minFragment && !(i == 0 && j == n) {
+				continue
+			}
+			if math.IsInf(cost[i], 1) {
+				continue
+			}
+			c := cost[i] + sums.deviation(i, j)
+			if i > 0 {
+				c += hingePenalty
+			}
+			if c < cost[j] {
+				cost[j], start[j] = c, i
+			}
+		}
+	}
+
+	ends := []int{}
+	for j := n; j > 0; j = start[j] {
+		ends = append(ends, j)
+	}
+	sum := 0.0
+	for k := len(ends) - 1; k >= 0; k-- {
+		j := ends[k]
+		i := start[j]
+		t, rmsd := QCPSuperpose(fixed[i:j], mobile[i:j], nil)
+		result.Fragments = append(result.Fragments, RigidFragment{Start: i, End: j - 1, Transform: t, RMSD: rmsd})
+		if i > 0 {
+			result.Hinges = append(result.Hinges, pairs[i])
+		}
+		sum += rmsd * rmsd * float64(j-i)
+	}
+	result.RMSD = math.Sqrt(sum / float64(n))
+	return result
+}
+
+// fragmentSums holds prefix sums of paired coordinates so that the optimal superposition of any run of pairs
+// can be scored in constant time, which keeps the split search quadratic in the number of pairs
+// the coordinates are centered on their overall centroids first to keep the sums small
+type fragmentSums struct {
+	fixed, mobile []vec3       // fixed[k] sums the first k centered fixed coordinates
+	squares       []float64    // squared lengths of the first k centered coordinates of both sets
+	cross         [][9]float64 // cross[k][3a+b] sums fixed[a] * mobile[b] over the first k pairs
+}
+
+// newFragmentSums builds the prefix sums of two paired coordinate slices
+func newFragmentSums(fixed, mobile []vec3) fragmentSums {
+	n := len(fixed)
+	centerFixed, centerMobile := centroid(fixed), centroid(mobile)
+	sums := fragmentSums{fixed: make([]vec3, n+1), mobile: make([]vec3, n+1), squares: make([]float64, n+1), cross: make([][9]float64, n+1)}
+	for k := range fixed {
+		f, m := fixed[k].Subtract(centerFixed), mobile[k].Subtract(centerMobile)
+		sums.fixed[k+1] = sums.fixed[k].Add(f)
+		sums.mobile[k+1] = sums.mobile[k].Add(m)
+		sums.squares[k+1] = sums.squares[k] + f.Dot(f) + m.Dot(m)
+		fa, mb := [3]float64{f.x, f.y, f.z}, [3]float64{m.x, m.y, m.z}
+		for a := 0; a < 3; a++ {
+			for b := 0; b < 3; b++ {
+				sums.cross[k+1][3*a+b] = sums.cross[k][3*a+b] + fa[a]*mb[b]
+			}
+		}
+	}
+	return sums
+}
+
+// deviation returns the summed squared deviation of pairs i to j-1 after their optimal superposition
+func (sums fragmentSums) deviation(i, j int) float64 {
+	n := float64(j - i)
+	centerFixed := sums.fixed[j].Subtract(sums.fixed[i]).Scale(1 / n)
+	centerMobile := sums.mobile[j].Subtract(sums.mobile[i]).Scale(1 / n)
+	cf := [3]float64{centerFixed.x, centerFixed.y, centerFixed.z}
+	cm := [3]float64{centerMobile.x, centerMobile.y, centerMobile.z}
+	// moving the sums to the fragment centroids
+	var s [9]float64
+	for a := 0; a < 3; a++ {
+		for b := 0; b < 3; b++ {
+			s[3*a+b] = sums.cross[j][3*a+b] - sums.cross[i][3*a+b] - n*cf[a]*cm[b]
+		}
+	}
+	e0 := sums.squares[j] - sums.squares[i] - n*(centerFixed.Dot(centerFixed)+centerMobile.Dot(centerMobile))
+	rmsd := qcpSolve(s, e0/2, n, nil)
+	return rmsd * rmsd * n
+}
+
+// PrintFlexibleAlignment prints the hinges and the range, RMSD and transform of every rigid fragment
+func PrintFlexibleAlignment(result FlexibleAlignment) {
+	fmt.Printf("Flexible alignment: %d hinges, %d rigid fragments, RMSD %.3f (rigid RMSD %.3f)\n", len(result.Hinges), len(result.Fragments), result.RMSD, result.RigidRMSD)
+	for _, hinge := range result.Hinges {
+		fmt.Printf("Hinge at %s %s %d%s / %s %s %d%s\n", hinge.Res1.chain, hinge.Res1.amino, hinge.Res1.resSeq, hinge.Res1.iCode,
+			hinge.Res2.chain, hinge.Res2.amino, hinge.Res2.resSeq, hinge.Res2.iCode)
+	}
+	for k, fragment := range result.Fragments {
+		first, last := result.Pairs[fragment.Start], result.Pairs[fragment.End]
+		fmt.Printf("Fragment %d: %s%d%s-%s%d%s / %s%d%s-%s%d%s, %d pairs, RMSD %.3f\n", k+1,
+			first.Res1.chain, first.Res1.resSeq, first.Res1.iCode, last.Res1.chain, last.Res1.resSeq, last.Res1.iCode,
+			first.Res2.chain, first.Res2.resSeq, first.Res2.iCode, last.Res2.chain, last.Res2.resSeq, last.Res2.iCode,
+			fragment.End-fragment.Start+1, fragment.RMSD)
+		PrintTransform(fragment.Transform)
+	}
+}
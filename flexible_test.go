@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFlexibleSuperpose(t *testing.T) {
+	reference := ParsePDB("pdbfiles/1mbn.pdb")
+	// the residues from the hinge on are rotated and shifted as one rigid body
+	model := ParsePDB("pdbfiles/1mbn.pdb")
+	const hinge = 80
+	move := Transform{Rotation: [3][3]float64{{0, 0, 1}, {1, 0, 0}, {0, 1, 0}}, Translation: vec3{5, -5, 10}}
+	for _, res := range Residues(model)[hinge:] {
+		for _, atom := range res.atoms {
+			p := move.Apply(vec3{atom.x, atom.y, atom.z})
+			atom.x, atom.y, atom.z = p.x, p.y, p.z
+		}
+	}
+	correspondences := identicalCorrespondences(reference, model)
+
+	result := FlexibleSuperpose(correspondences, 10, 5)
+	if len(result.Fragments) != 2 || len(result.Hinges) != 1 {
+		t.Fatalf("FlexibleSuperpose found %d fragments and %d hinges, want 2 and 1", len(result.Fragments), len(result.Hinges))
+	}
+	if got := result.Fragments[1].Start; got != hinge || result.Fragments[0].End != hinge-1 {
+		t.Errorf("FlexibleSuperpose split the pairs at %d, want %d", got, hinge)
+	}
+	if last := result.Fragments[1].End; last != len(result.Pairs)-1 {
+		t.Errorf("last fragment ends at pair %d, want %d", last, len(result.Pairs)-1)
+	}
+	if result.RMSD > 1e-6 || result.RigidRMSD < 1 {
+		t.Errorf("FlexibleSuperpose RMSD = %v, rigid RMSD = %v, want 0 and a poor rigid fit", result.RMSD, result.RigidRMSD)
+	}
+
+	// a hinge that costs more than the whole rigid deviation is never worth it
+	penalty := result.RigidRMSD * result.RigidRMSD * float64(len(result.Pairs))
+	rigid := FlexibleSuperpose(correspondences, penalty+1, 5)
+	if len(rigid.Fragments) != 1 || len(rigid.Hinges) != 0 || math.Abs(rigid.RMSD-rigid.RigidRMSD) > 1e-9 {
+		t.Errorf("FlexibleSuperpose with a prohibitive hinge penalty found %d fragments, RMSD %v, rigid RMSD %v",
+			len(rigid.Fragments), rigid.RMSD, rigid.RigidRMSD)
+	}
+
+	// an unmoved copy is one fragment
+	if same := FlexibleSuperpose(identicalCorrespondences(reference, reference), 0.1, 5); len(same.Fragments) != 1 {
+		t.Errorf("FlexibleSuperpose of a structure with itself found %d fragments, want 1", len(same.Fragments))
+	}
+}
+
+func TestFragmentSums(t *testing.T) {
+	// alpha carbons of two unrelated proteins, so every fragment has a different nonzero deviation
+	fixed := AtomCoordinates(AlphaCarbons(ParsePDB("pdbfiles/1mbn.pdb")))[:60]
+	mobile := AtomCoordinates(AlphaCarbons(ParsePDB("pdbfiles/1lyz.pdb")))[:60]
+	sums := newFragmentSums(fixed, mobile)
+	for i := 0; i < len(fixed); i += 7 {
+		for j := i + 3; j <= len(fixed); j += 5 {
+			_, rmsd := QCPSuperpose(fixed[i:j], mobile[i:j], nil)
+			want := rmsd * rmsd * float64(j-i)
+			if got := sums.deviation(i, j); math.Abs(got-want) > 1e-6*math.Max(1, want) {
+				t.Errorf("deviation(%d, %d) = %v, want %v", i, j, got, want)
+			}
+		}
+	}
+}
@@ -55,6 +55,13 @@ func RayColor(r *Ray, light *Light, camera *Camera, atoms []*Atom, atoms_sequenc
 	for i := 0; i < len(atoms); i++ {
 		collision := RaySphereCollision(r, atoms[i])
 		if !collision.getNormal().EqualsZero() {
+			if atoms[i].interaction != "" {
+				// dashed lines of interactions keep their own colors
+				if !showInteractions {
+					continue
+				}
+				return PhongShading(collision, light, camera, interactionColors[atoms[i].interaction])
+			}
 			if colorByChain {
 				if atoms[i].chain == "A" {
 					collision.color = PhongShading(collision, light, camera, vec3{0.2, 0.7, 0.1})
@@ -74,9 +81,17 @@ func RayColor(r *Ray, light *Light, camera *Camera, atoms []*Atom, atoms_sequenc
 					collision.color = PhongShading(collision, light, camera, vec3{0.188, 0.313, 0.9725})
 				} else if atoms[i].element == "O" {
 					collision.color = PhongShading(collision, light, camera, vec3{1.0, 0.051, 0.051})
-				} else if atoms[i].element == "S" {
+				} else if atoms[i].symbol == "S" {
 					collision.color = PhongShading(collision, light, camera, vec3{1.0, 0.784, 0.196})
 				}
+			} else if colorByRMSF {
+				collision.color = PhongShading(collision, light, camera, RMSFColor(atoms[i].rmsf, maxRMSF))
+			} else if colorByInterface {
+				if atoms[i].interfaceRes {
+					collision.color = PhongShading(collision, light, camera, vec3{1.0, 0.55, 0.0})
+				} else {
+					collision.color = PhongShading(collision, light, camera, vec3{0.565, 0.565, 0.565})
+				}
 			} else if colorByDifferingRegions {
 				if alignedSeq1[atoms[i].seqIndex] != alignedSeq2[atoms[i].seqIndex] {
 					collision.color = PhongShading(collision, light, camera, vec3{0.69, 0.22, 0.188})
@@ -247,6 +262,33 @@ func GetQuerySequence(atoms []*Atom) string {
 	return sequence
 }
 
+// Residues groups a slice of atoms into residues in the same order used by GetQuerySequence,
+// so that residue i corresponds to character i of the query sequence
+func Residues(atoms []*Atom) []Residue {
+	residues := make([]Residue, 0)
+	current_ind := -100
+	for i := 0; i < len(atoms); i++ {
+		if atoms[i].seqIndex != current_ind {
+			residues = append(residues, Residue{amino: atoms[i].amino, chain: atoms[i].chain, seqIndex: atoms[i].seqIndex,
+				resSeq: atoms[i].resSeq, iCode: atoms[i].iCode})
+			current_ind = atoms[i].seqIndex
+		}
+		residues[len(residues)-1].atoms = append(residues[len(residues)-1].atoms, atoms[i])
+	}
+	return residues
+}
+
+// AlphaCarbons returns only the alpha carbon atoms of a slice of atoms, one per residue
+func AlphaCarbons(atoms []*Atom) []*Atom {
+	alphaCarbons := make([]*Atom, 0)
+	for _, atom := range atoms {
+		if atom.element == "CA" {
+			alphaCarbons = append(alphaCarbons, atom)
+		}
+	}
+	return alphaCarbons
+}
+
 // ConvertAminoAcidToSingleChar converts a 3 letter amino acid to a single character code
 // this is to make it easier to perform sequence alignment, this way each index is associated
 // with a single character in the amino acid sequence
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// geometric criteria of the non-covalent interactions, distances in angstroms and angles in degrees
+const (
+	hydrogenBondLength  = 1.01 // N-H and O-H bond length used to place implicit hydrogens
+	hbondHAcceptorMax   = 2.5  // hydrogen to acceptor distance of a hydrogen bond with a placed hydrogen
+	hbondDHAMinAngle    = 120  // smallest donor-hydrogen-acceptor angle
+	hbondAntecedentMin  = 90   // smallest antecedent-donor-acceptor angle when the hydrogen cannot be placed
+	disulfideMax        = 2.5  // longest SG-SG bond
+	cationPiMax         = 6.0  // cation to ring centroid distance
+	cationPiMaxOffset   = 60   // largest angle between the ring normal and the direction to the cation
+	piStackingMax       = 5.5  // distance between ring centroids
+	piParallelMaxAngle  = 30   // largest angle between the ring planes of parallel stacking
+	piTShapedMinAngle   = 60   // smallest angle between the ring planes of T-shaped stacking
+	peptideBondMax      = 2.0  // longest C-N distance of residues joined by a peptide bond
+	interactionDashStep = 0.6  // spacing of the spheres drawing an interaction as a dashed line
+)
+
+// heavy atoms bonded to every side chain donor; donors with two bonded heavy atoms carry a hydrogen on their
+// bisector, the others have a rotatable hydrogen and are judged by the angle at the donor
+var donorNeighbors = map[string]map[string][]string{
+	"ARG": {"NE": {"CD", "CZ"}, "NH1": {"CZ"}, "NH2": {"CZ"}},
+	"ASN": {"ND2": {"CG"}},
+	"GLN": {"NE2": {"CD"}},
+	"HIS": {"ND1": {"CG", "CE1"}, "NE2": {"CD2", "CE1"}},
+	"LYS": {"NZ": {"CE"}},
+	"SER": {"OG": {"CB"}},
+	"THR": {"OG1": {"CB"}},
+	"TYR": {"OH": {"CZ"}},
+	"TRP": {"NE1": {"CD1", "CE2"}},
+}
+
+// aromatic rings by residue
+var aromaticRings = map[string][][]string{
+	"PHE": {{"CG", "CD1", "CD2", "CE1", "CE2", "CZ"}},
+	"TYR": {{"CG", "CD1", "CD2", "CE1", "CE2", "CZ"}},
+	"TRP": {{"CD2", "CE2", "CE3", "CZ2", "CZ3", "CH2"}, {"CG", "CD1", "NE1", "CE2", "CD2"}},
+	"HIS": {{"CG", "ND1", "CD2", "CE1", "NE2"}},
+}
+
+// colors of the dashed lines of every interaction type
+var interactionColors = map[string]vec3{
+	"hbond-backbone":  {0.3, 0.8, 1.0},
+	"hbond-sidechain": {0.6, 0.9, 1.0},
+	"salt-bridge":     {1.0, 0.3, 0.3},
+	"disulfide":       {1.0, 0.9, 0.2},
+	"cation-pi":       {0.3, 1.0, 0.3},
+	"pi-stacking":     {1.0, 0.6, 0.1},
+	"pi-t-shaped":     {1.0, 0.45, 0.6},
+}
+
+// Interaction is a non-covalent interaction or disulfide bond between two residues
+type Interaction struct {
+	Type           string // hbond-backbone, hbond-sidechain, salt-bridge, disulfide, cation-pi, pi-stacking or pi-t-shaped
+	Res1, Res2     *Residue
+	Atom1, Atom2   string // names of the interacting atoms, or "ring" for an aromatic ring centroid
+	Point1, Point2 vec3   // positions of the interacting atoms or ring centroids
+	Distance       float64
+	Angle          float64 // angle a hydrogen bond was judged by, or between ring planes or ring normal and cation
+}
+
+// aromaticRing is the centroid and plane normal of an aromatic ring
+type aromaticRing struct {
+	res      *Residue
+	centroid vec3
+	normal   vec3
+}
+
+// FindInteractions detects hydrogen bonds (placing implicit hydrogens where the geometry defines them), salt
+// bridges, disulfide bonds, cation-pi and pi-pi interactions in a structure; structures with several models are
+// analyzed in their first model
+func FindInteractions(atoms []*Atom) []Interaction {
+	if len(atoms) == 0 {
+		return []Interaction{}
+	}
+	atoms = SplitModels(atoms)[0]
+	residues := Residues(atoms)
+	residueOf := make(map[int]*Residue, len(residues))
+	for i := range residues {
+		residueOf[residues[i].seqIndex] = &residues[i]
+	}
+
+	interactions := []Interaction{}
+	// salt bridges and aromatic interactions are reported once per residue pair, by their closest atoms or rings
+	closest := make(map[string]int)
+	keepClosest := func(interaction Interaction) {
+		key := fmt.Sprintf("%s %d %d", interaction.Type, interaction.Res1.seqIndex, interaction.Res2.seqIndex)
+		if k, ok := closest[key]; !ok {
+			closest[key] = len(interactions)
+			interactions = append(interactions, interaction)
+		} else if interaction.Distance < interactions[k].Distance {
+			interactions[k] = interaction
+		}
+	}
+	reach := math.Max(hbondCutoff, saltBridgeCut)
+	for _, pair := range NewAtomIndex(atoms, reach).Pairs(reach) {
+		a, b := atoms[pair[0]], atoms[pair[1]]
+		if a.seqIndex == b.seqIndex {
+			continue
+		}
+		d := Distance(a, b)
+		res1, res2 := residueOf[a.seqIndex], residueOf[b.seqIndex]
+
+		if d <= disulfideMax && a.element == "SG" && b.element == "SG" {
+			interactions = append(interactions, newInteraction("disulfide", res1, res2, a, b, 0))
+			continue
+		}
+		if d <= saltBridgeCut && ((hasAtomName(acidicAtoms, a) && hasAtomName(basicAtoms, b)) || (hasAtomName(basicAtoms, a) && hasAtomName(acidicAtoms, b))) {
+			keepClosest(newInteraction("salt-bridge", res1, res2, a, b, 0))
+		}
+		if d <= hbondCutoff {
+			for _, roles := range [][2]*Atom{{a, b}, {b, a}} {
+				donor, acceptor := roles[0], roles[1]
+				if !isDonor(donor) || !isAcceptor(acceptor) {
+					continue
+				}
+				if angle, ok := hydrogenBond(donor, acceptor, residueOf); ok {
+					kind := "hbond-sidechain"
+					if InAtomSet(donor, "backbone") && InAtomSet(acceptor, "backbone") {
+						kind = "hbond-backbone"
+					}
+					interactions = append(interactions, newInteraction(kind, residueOf[donor.seqIndex], residueOf[acceptor.seqIndex], donor, acceptor, angle))
+				}
+			}
+		}
+	}
+
+	// interactions of aromatic rings
+	rings := []aromaticRing{}
+	for i := range residues {
+		rings = append(rings, residueRings(&residues[i])...)
+	}
+	for i := range rings {
+		for j := i + 1; j < len(rings); j++ {
+			if rings[i].res == rings[j].res {
+				continue
+			}
+			d := rings[i].centroid.Subtract(rings[j].centroid).Length()
+			if d > piStackingMax {
+				continue
+			}
+			angle := planeAngle(rings[i].normal, rings[j].normal)
+			kind := ""
+			if angle <= piParallelMaxAngle {
+				kind = "pi-stacking"
+			} else if angle >= piTShapedMinAngle {
+				kind = "pi-t-shaped"
+			} else {
+				continue
+			}
+			keepClosest(Interaction{Type: kind, Res1: rings[i].res, Res2: rings[j].res, Atom1: "ring", Atom2: "ring",
+				Point1: rings[i].centroid, Point2: rings[j].centroid, Distance: d, Angle: angle})
+		}
+	}
+	for _, atom := range atoms {
+		if !((atom.amino == "LYS" && atom.element == "NZ") || (atom.amino == "ARG" && atom.element == "CZ")) {
+			continue
+		}
+		p := vec3{atom.x, atom.y, atom.z}
+		for _, ring := range rings {
+			offset := p.Subtract(ring.centroid)
+			d := offset.Length()
+			if d > cationPiMax {
+				continue
+			}
+			angle := planeAngle(ring.normal, offset.Normalize())
+			if angle <= cationPiMaxOffset {
+				keepClosest(Interaction{Type: "cation-pi", Res1: residueOf[atom.seqIndex], Res2: ring.res, Atom1: atom.element, Atom2: "ring",
+					Point1: p, Point2: ring.centroid, Distance: d, Angle: angle})
+			}
+		}
+	}
+
+	sort.SliceStable(interactions, func(i, j int) bool {
+		a, b := interactions[i], interactions[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Res1.seqIndex != b.Res1.seqIndex {
+			return a.Res1.seqIndex < b.Res1.seqIndex
+		}
+		return a.Res2.seqIndex < b.Res2.seqIndex
+	})
+	return interactions
+}
+
+// hydrogenBond decides whether donor and acceptor form a hydrogen bond and returns the angle it was judged by
+// the backbone N and side chain donors with two bonded heavy atoms get a hydrogen on the bisector of their bonds
+// and need a short hydrogen-acceptor distance and a wide donor-hydrogen-acceptor angle; other donors need a wide
+// antecedent-donor-acceptor angle
+func hydrogenBond(donor, acceptor *Atom, residueOf map[int]*Residue) (float64, bool) {
+	res := residueOf[donor.seqIndex]
+	neighbors := []*Atom{}
+	if donor.element == "N" {
+		neighbors = append(neighbors, residueAtom(res, "CA"))
+		if prev, ok := residueOf[donor.seqIndex-1]; ok && prev.chain == res.chain {
+			if c := residueAtom(prev, "C"); c != nil && Distance(c, donor) <= peptideBondMax {
+				neighbors = append(neighbors, c)
+			}
+		}
+	} else {
+		for _, name := range donorNeighbors[donor.amino][donor.element] {
+			neighbors = append(neighbors, residueAtom(res, name))
+		}
+	}
+	for _, neighbor := range neighbors {
+		if neighbor == nil {
+			return 0, false
+		}
+	}
+	d := vec3{donor.x, donor.y, donor.z}
+	a := vec3{acceptor.x, acceptor.y, acceptor.z}
+
+	if len(neighbors) == 2 {
+		h := ImplicitHydrogen(donor, neighbors[0], neighbors[1])
+		angle := vectorAngle(d.Subtract(h), a.Subtract(h))
+		return angle, a.Subtract(h).Length() <= hbondHAcceptorMax && angle >= hbondDHAMinAngle
+	}
+	if len(neighbors) == 1 {
+		antecedent := vec3{neighbors[0].x, neighbors[0].y, neighbors[0].z}
+		angle := vectorAngle(antecedent.Subtract(d), a.Subtract(d))
+		return angle, angle >= hbondAntecedentMin
+	}
+	return 0, false
+}
+
+// ImplicitHydrogen places the hydrogen of a donor bonded to two heavy atoms in their plane, pointing away from both
+// along the bisector of the two bonds, as for the backbone N-H
+func ImplicitHydrogen(donor, neighbor1, neighbor2 *Atom) vec3 {
+	d := vec3{donor.x, donor.y, donor.z}
+	u1 := d.Subtract(vec3{neighbor1.x, neighbor1.y, neighbor1.z}).Normalize()
+	u2 := d.Subtract(vec3{neighbor2.x, neighbor2.y, neighbor2.z}).Normalize()
+	return d.Add(u1.Add(u2).Normalize().Scale(hydrogenBondLength))
+}
+
+// residueRings returns the aromatic rings of a residue with all their atoms present
+func residueRings(res *Residue) []aromaticRing {
+	rings := []aromaticRing{}
+	for _, names := range aromaticRings[res.amino] {
+		points := []vec3{}
+		for _, name := range names {
+			if atom := residueAtom(res, name); atom != nil {
+				points = append(points, vec3{atom.x, atom.y, atom.z})
+			}
+		}
+		if len(points) != len(names) {
+			continue
+		}
+		center := centroid(points)
+		normal := points[0].Subtract(center).Cross(points[2].Subtract(center)).Normalize()
+		rings = append(rings, aromaticRing{res, center, normal})
+	}
+	return rings
+}
+
+// newInteraction returns an interaction between two atoms
+func newInteraction(kind string, res1, res2 *Residue, a, b *Atom, angle float64) Interaction {
+	return Interaction{Type: kind, Res1: res1, Res2: res2, Atom1: a.element, Atom2: b.element,
+		Point1: vec3{a.x, a.y, a.z}, Point2: vec3{b.x, b.y, b.z}, Distance: Distance(a, b), Angle: angle}
+}
+
+// vectorAngle returns the angle between two vectors in degrees
+func vectorAngle(u, v vec3) float64 {
+	cos := u.Dot(v) / (u.Length() * v.Length())
+	return math.Acos(math.Max(-1, math.Min(1, cos))) * 180 / math.Pi
+}
+
+// planeAngle returns the angle in degrees between two undirected normals, from 0 to 90
+func planeAngle(u, v vec3) float64 {
+	angle := vectorAngle(u, v)
+	if angle > 90 {
+		angle = 180 - angle
+	}
+	return angle
+}
+
+// InteractionDashes returns small spheres spaced along every interaction so that the renderer draws them as dashed
+// lines colored by type
+func InteractionDashes(interactions []Interaction) []*Atom {
+	dashes := []*Atom{}
+	for _, interaction := range interactions {
+		line := interaction.Point2.Subtract(interaction.Point1)
+		steps := int(line.Length() / interactionDashStep)
+		for s := 1; s < steps; s++ {
+			p := interaction.Point1.Add(line.Scale(float64(s) / float64(steps)))
+			dashes = append(dashes, &Atom{amino: interaction.Res1.amino, chain: interaction.Res1.chain, seqIndex: interaction.Res1.seqIndex,
+				resSeq: interaction.Res1.resSeq, x: p.x, y: p.y, z: p.z, radius: 0.15, interaction: interaction.Type})
+		}
+	}
+	return dashes
+}
+
+// PrintInteractionCounts prints the number of interactions of every type
+func PrintInteractionCounts(name string, interactions []Interaction) {
+	counts := make(map[string]int)
+	for _, interaction := range interactions {
+		counts[interaction.Type]++
+	}
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	fmt.Printf("Interactions of %s: %d\n", name, len(interactions))
+	for _, t := range types {
+		fmt.Printf("  %-16s %d\n", t, counts[t])
+	}
+	fmt.Println()
+}
+
+// InteractionTable formats the interactions as tab separated values, one per line
+func InteractionTable(interactions []Interaction) string {
+	var sb strings.Builder
+	sb.WriteString("type\tchain1\tresidue1\tnumber1\tatom1\tchain2\tresidue2\tnumber2\tatom2\tdistance\tangle\n")
+	for _, i := range interactions {
+		sb.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d%s\t%s\t%s\t%s\t%d%s\t%s\t%.2f\t%.1f\n", i.Type,
+			i.Res1.chain, i.Res1.amino, i.Res1.resSeq, i.Res1.iCode, i.Atom1,
+			i.Res2.chain, i.Res2.amino, i.Res2.resSeq, i.Res2.iCode, i.Atom2, i.Distance, i.Angle))
+	}
+	return sb.String()
+}
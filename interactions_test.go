@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHydrogenBond(t *testing.T) {
+	// a backbone N at the origin whose bonds to CA and the previous C put its hydrogen at 1.01 angstroms along x
+	prev := &Residue{amino: "GLY", chain: "A", seqIndex: 0, atoms: []*Atom{{element: "C", amino: "GLY", chain: "A", seqIndex: 0, x: -0.7, y: -1.2}}}
+	donorRes := &Residue{amino: "ALA", chain: "A", seqIndex: 1, atoms: []*Atom{
+		{element: "N", amino: "ALA", chain: "A", seqIndex: 1},
+		{element: "CA", amino: "ALA", chain: "A", seqIndex: 1, x: -0.7, y: 1.2},
+	}}
+	// a serine OG at the origin bonded to its CB along -x, with a rotatable hydrogen
+	serine := &Residue{amino: "SER", chain: "A", seqIndex: 3, atoms: []*Atom{
+		{element: "OG", amino: "SER", chain: "A", seqIndex: 3},
+		{element: "CB", amino: "SER", chain: "A", seqIndex: 3, x: -1.43},
+	}}
+	residueOf := map[int]*Residue{0: prev, 1: donorRes, 3: serine}
+
+	h := ImplicitHydrogen(donorRes.atoms[0], donorRes.atoms[1], prev.atoms[0])
+	if h.Subtract(vec3{hydrogenBondLength, 0, 0}).Length() > 1e-12 {
+		t.Errorf("ImplicitHydrogen = %v, want %v", h, vec3{hydrogenBondLength, 0, 0})
+	}
+
+	// an acceptor 1.9 angstroms from the hydrogen in the direction making the given donor-hydrogen-acceptor angle
+	acceptorAt := func(from vec3, distance, angle float64) *Atom {
+		phi := (180 - angle) * math.Pi / 180
+		p := from.Add(vec3{math.Cos(phi), math.Sin(phi), 0}.Scale(distance))
+		return &Atom{element: "O", amino: "GLY", chain: "B", seqIndex: 9, x: p.x, y: p.y, z: p.z}
+	}
+	tests := []struct {
+		name     string
+		donor    *Atom
+		acceptor *Atom
+		angle    float64
+		want     bool
+	}{
+		{"a linear backbone bond", donorRes.atoms[0], acceptorAt(h, 1.9, 180), 180, true},
+		{"a bent backbone bond", donorRes.atoms[0], acceptorAt(h, 1.9, 150), 150, true},
+		{"a backbone bond bent too far", donorRes.atoms[0], acceptorAt(h, 1.9, 110), 110, false},
+		{"a hydrogen too far from the acceptor", donorRes.atoms[0], acceptorAt(h, 2.6, 180), 180, false},
+		// the side chain donor is judged by the angle at the donor between its antecedent and the acceptor
+		{"a side chain bond", serine.atoms[0], acceptorAt(vec3{}, 2.8, 100), 100, true},
+		{"a side chain acceptor behind the donor", serine.atoms[0], acceptorAt(vec3{}, 2.8, 80), 80, false},
+	}
+	for _, test := range tests {
+		angle, ok := hydrogenBond(test.donor, test.acceptor, residueOf)
+		if ok != test.want || math.Abs(angle-test.angle) > 1e-9 {
+			t.Errorf("hydrogenBond of %s = %.2f degrees, %v, want %.2f, %v", test.name, angle, ok, test.angle, test.want)
+		}
+	}
+
+	// without its CA the backbone hydrogen cannot be placed
+	bare := &Residue{amino: "ALA", chain: "A", seqIndex: 1, atoms: donorRes.atoms[:1]}
+	if _, ok := hydrogenBond(bare.atoms[0], acceptorAt(h, 1.9, 180), map[int]*Residue{0: prev, 1: bare}); ok {
+		t.Errorf("hydrogenBond of a backbone N without its CA = true, want false")
+	}
+}
+
+func TestFindInteractionsHydrogenBond(t *testing.T) {
+	atoms := []*Atom{
+		{element: "C", amino: "GLY", chain: "A", seqIndex: 0, x: -0.7, y: -1.2},
+		{element: "N", amino: "ALA", chain: "A", seqIndex: 1},
+		{element: "CA", amino: "ALA", chain: "A", seqIndex: 1, x: -0.7, y: 1.2},
+		{element: "O", amino: "GLY", chain: "B", seqIndex: 9, x: 2.9},
+	}
+	interactions := FindInteractions(atoms)
+	if len(interactions) != 1 {
+		t.Fatalf("FindInteractions found %d interactions, want 1", len(interactions))
+	}
+	got := interactions[0]
+	if got.Type != "hbond-backbone" || got.Atom1 != "N" || got.Atom2 != "O" || math.Abs(got.Distance-2.9) > 1e-12 {
+		t.Errorf("FindInteractions = %s %s-%s at %.2f, want hbond-backbone N-O at 2.90", got.Type, got.Atom1, got.Atom2, got.Distance)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// distance cutoffs in angstroms for interactions between heavy atoms
+const (
+	interfaceCutoff = 5.0 // default closest heavy atom distance of two residues in contact
+	hbondCutoff     = 3.5 // donor to acceptor distance of a hydrogen bond
+	saltBridgeCut   = 4.0 // distance between oppositely charged side chain atoms of a salt bridge
+)
+
+// residue classes used to count contacts by residue type
+var residueClasses = map[string]string{
+	"ALA": "hydrophobic", "VAL": "hydrophobic", "LEU": "hydrophobic", "ILE": "hydrophobic", "MET": "hydrophobic",
+	"PHE": "hydrophobic", "TRP": "hydrophobic", "PRO": "hydrophobic", "GLY": "hydrophobic", "CYS": "hydrophobic",
+	"SER": "polar", "THR": "polar", "ASN": "polar", "GLN": "polar", "TYR": "polar", "HIS": "polar",
+	"ASP": "charged", "GLU": "charged", "LYS": "charged", "ARG": "charged",
+}
+
+// side chain hydrogen bond donors and acceptors by residue; the backbone N (except proline) donates and O accepts
+var (
+	sideChainDonors = map[string][]string{
+		"ARG": {"NE", "NH1", "NH2"}, "ASN": {"ND2"}, "GLN": {"NE2"}, "HIS": {"ND1", "NE2"}, "LYS": {"NZ"},
+		"SER": {"OG"}, "THR": {"OG1"}, "TYR": {"OH"}, "TRP": {"NE1"},
+	}
+	sideChainAcceptors = map[string][]string{
+		"ASP": {"OD1", "OD2"}, "GLU": {"OE1", "OE2"}, "ASN": {"OD1"}, "GLN": {"OE1"}, "HIS": {"ND1", "NE2"},
+		"SER": {"OG"}, "THR": {"OG1"}, "TYR": {"OH"},
+	}
+	acidicAtoms = map[string][]string{"ASP": {"OD1", "OD2"}, "GLU": {"OE1", "OE2"}}
+	basicAtoms  = map[string][]string{"LYS": {"NZ"}, "ARG": {"NE", "NH1", "NH2"}}
+)
+
+// AtomContact is a pair of atoms with the distance between them
+type AtomContact struct {
+	Atom1, Atom2 *Atom
+	Distance     float64
+}
+
+// InterfaceContact is a pair of residues of different chains with the distance between their closest heavy atoms
+type InterfaceContact struct {
+	Res1, Res2  *Residue
+	Distance    float64
+	Type        string // the classes of the two residues, such as hydrophobic-polar
+	HBonds      int
+	SaltBridges int
+}
+
+// ChainInterface describes the contacts between two chains of a structure
+type ChainInterface struct {
+	Chain1, Chain2       string
+	Contacts             []InterfaceContact
+	Residues1, Residues2 []*Residue     // interface residues of each chain in sequence order
+	TypeCounts           map[string]int // residue pair contacts by the classes of the two residues
+	BuriedArea           float64        // solvent accessible area of the two chains lost on binding
+	HBonds               []AtomContact  // donor and acceptor atoms closer than hbondCutoff
+	SaltBridges          []AtomContact  // acidic and basic side chain atoms closer than saltBridgeCut
+}
+
+// ChainInterfaces finds every pair of chains with residues whose heavy atoms come closer than cutoff and describes
+// their interface; structures with several models are analyzed in their first model
+func ChainInterfaces(atoms []*Atom, cutoff float64) []ChainInterface {
+	if len(atoms) == 0 {
+		return []ChainInterface{}
+	}
+	atoms = SplitModels(atoms)[0]
+	residues := Residues(atoms)
+	residueOf := make(map[int]*Residue, len(residues))
+	for i := range residues {
+		residueOf[residues[i].seqIndex] = &residues[i]
+	}
+
+	// closest atom pair of every residue pair across chains, with the polar interactions between them
+	contacts := make(map[[2]int]*InterfaceContact)
+	bonds := make(map[[2]string][2][]AtomContact)
+	reach := math.Max(cutoff, math.Max(hbondCutoff, saltBridgeCut))
+	for _, pair := range NewAtomIndex(atoms, reach).Pairs(reach) {
+		a, b := atoms[pair[0]], atoms[pair[1]]
+		if a.chain == b.chain {
+			continue
+		}
+		if a.chain > b.chain {
+			a, b = b, a
+		}
+		d := Distance(a, b)
+		chains := [2]string{a.chain, b.chain}
+		key := [2]int{a.seqIndex, b.seqIndex}
+		if d < cutoff {
+			contact, ok := contacts[key]
+			if !ok {
+				res1, res2 := residueOf[a.seqIndex], residueOf[b.seqIndex]
+				contact = &InterfaceContact{Res1: res1, Res2: res2, Distance: d, Type: contactType(res1.amino, res2.amino)}
+				contacts[key] = contact
+			}
+			contact.Distance = math.Min(contact.Distance, d)
+		}
+		found := bonds[chains]
+		if d <= hbondCutoff && ((isDonor(a) && isAcceptor(b)) || (isAcceptor(a) && isDonor(b))) {
+			found[0] = append(found[0], AtomContact{a, b, d})
+		}
+		if d <= saltBridgeCut && ((hasAtomName(acidicAtoms, a) && hasAtomName(basicAtoms, b)) || (hasAtomName(basicAtoms, a) && hasAtomName(acidicAtoms, b))) {
+			found[1] = append(found[1], AtomContact{a, b, d})
+		}
+		bonds[chains] = found
+	}
+
+	// group the residue contacts by chain pair
+	byChains := make(map[[2]string]*ChainInterface)
+	keys := [][2]string{}
+	for _, contact := range contacts {
+		chains := [2]string{contact.Res1.chain, contact.Res2.chain}
+		if _, ok := byChains[chains]; !ok {
+			byChains[chains] = &ChainInterface{Chain1: chains[0], Chain2: chains[1], TypeCounts: make(map[string]int)}
+			keys = append(keys, chains)
+		}
+		byChains[chains].Contacts = append(byChains[chains].Contacts, *contact)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || (keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1])
+	})
+
+	chainAtoms := make(map[string][]*Atom)
+	chainArea := make(map[string]float64)
+	for _, atom := range atoms {
+		chainAtoms[atom.chain] = append(chainAtoms[atom.chain], atom)
+	}
+	interfaces := make([]ChainInterface, 0, len(keys))
+	for _, chains := range keys {
+		iface := byChains[chains]
+		sort.Slice(iface.Contacts, func(i, j int) bool {
+			ci, cj := iface.Contacts[i], iface.Contacts[j]
+			return ci.Res1.seqIndex < cj.Res1.seqIndex || (ci.Res1.seqIndex == cj.Res1.seqIndex && ci.Res2.seqIndex < cj.Res2.seqIndex)
+		})
+		iface.HBonds, iface.SaltBridges = bonds[chains][0], bonds[chains][1]
+		for k := range iface.Contacts {
+			contact := &iface.Contacts[k]
+			iface.TypeCounts[contact.Type]++
+			contact.HBonds = countBetween(iface.HBonds, contact.Res1, contact.Res2)
+			contact.SaltBridges = countBetween(iface.SaltBridges, contact.Res1, contact.Res2)
+		}
+		iface.Residues1, iface.Residues2 = interfaceResidues(iface.Contacts)
+
+		for _, chain := range chains {
+			if _, ok := chainArea[chain]; !ok {
+				chainArea[chain] = TotalSASA(chainAtoms[chain])
+			}
+		}
+		complexAtoms := append(append([]*Atom{}, chainAtoms[chains[0]]...), chainAtoms[chains[1]]...)
+		iface.BuriedArea = chainArea[chains[0]] + chainArea[chains[1]] - TotalSASA(complexAtoms)
+		interfaces = append(interfaces, *iface)
+	}
+	return interfaces
+}
+
+// MarkInterfaceAtoms flags the atoms of every interface residue so that the renderer can highlight them
+func MarkInterfaceAtoms(interfaces []ChainInterface) {
+	for _, iface := range interfaces {
+		for _, res := range append(append([]*Residue{}, iface.Residues1...), iface.Residues2...) {
+			for _, atom := range res.atoms {
+				atom.interfaceRes = true
+			}
+		}
+	}
+}
+
+// contactType names the classes of two residues in alphabetical order, such as charged-hydrophobic
+func contactType(amino1, amino2 string) string {
+	class1, class2 := residueClass(amino1), residueClass(amino2)
+	if class1 > class2 {
+		class1, class2 = class2, class1
+	}
+	return class1 + "-" + class2
+}
+
+// residueClass returns hydrophobic, polar or charged for a standard residue and other otherwise
+func residueClass(amino string) string {
+	if class, ok := residueClasses[amino]; ok {
+		return class
+	}
+	return "other"
+}
+
+// isDonor reports whether a heavy atom can donate a hydrogen bond
+func isDonor(atom *Atom) bool {
+	return (atom.element == "N" && atom.amino != "PRO") || hasAtomName(sideChainDonors, atom)
+}
+
+// isAcceptor reports whether a heavy atom can accept a hydrogen bond
+func isAcceptor(atom *Atom) bool {
+	return atom.element == "O" || atom.element == "OXT" || hasAtomName(sideChainAcceptors, atom)
+}
+
+// hasAtomName reports whether the atom is listed for its residue type
+func hasAtomName(names map[string][]string, atom *Atom) bool {
+	for _, name := range names[atom.amino] {
+		if atom.element == name {
+			return true
+		}
+	}
+	return false
+}
+
+// countBetween counts the atom contacts between two residues
+func countBetween(contacts []AtomContact, res1, res2 *Residue) int {
+	count := 0
+	for _, c := range contacts {
+		if (c.Atom1.seqIndex == res1.seqIndex && c.Atom2.seqIndex == res2.seqIndex) || (c.Atom1.seqIndex == res2.seqIndex && c.Atom2.seqIndex == res1.seqIndex) {
+			count++
+		}
+	}
+	return count
+}
+
+// interfaceResidues returns the distinct residues of each side of a set of contacts in sequence order
+func interfaceResidues(contacts []InterfaceContact) ([]*Residue, []*Residue) {
+	seen1, seen2 := make(map[int]bool), make(map[int]bool)
+	residues1, residues2 := []*Residue{}, []*Residue{}
+	for _, c := range contacts {
+		if !seen1[c.Res1.seqIndex] {
+			seen1[c.Res1.seqIndex] = true
+			residues1 = append(residues1, c.Res1)
+		}
+		if !seen2[c.Res2.seqIndex] {
+			seen2[c.Res2.seqIndex] = true
+			residues2 = append(residues2, c.Res2)
+		}
+	}
+	sort.Slice(residues2, func(i, j int) bool { return residues2[i].seqIndex < residues2[j].seqIndex })
+	return residues1, residues2
+}
+
+// PrintInterfaces prints a summary of every chain interface of a structure
+func PrintInterfaces(name string, interfaces []ChainInterface) {
+	fmt.Printf("Interfaces of %s: %d chain pairs in contact\n", name, len(interfaces))
+	for _, iface := range interfaces {
+		fmt.Printf("  %s-%s: %d residue pairs, %d + %d interface residues, buried area %.1f A^2, %d hydrogen bonds, %d salt bridges\n",
+			iface.Chain1, iface.Chain2, len(iface.Contacts), len(iface.Residues1), len(iface.Residues2), iface.BuriedArea, len(iface.HBonds), len(iface.SaltBridges))
+		types := make([]string, 0, len(iface.TypeCounts))
+		for t := range iface.TypeCounts {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		for _, t := range types {
+			fmt.Printf("    %-24s %d\n", t, iface.TypeCounts[t])
+		}
+	}
+	fmt.Println()
+}
+
+// InterfaceTable formats the residue pairs of every interface as tab separated values, preceded by one comment
+// line per interface with its summary
+func InterfaceTable(interfaces []ChainInterface) string {
+	var sb strings.Builder
+	for _, iface := range interfaces {
+		sb.WriteString(fmt.Sprintf("# %s-%s residue_pairs=%d residues1=%d residues2=%d buried_area=%.1f hbonds=%d salt_bridges=%d\n",
+			iface.Chain1, iface.Chain2, len(iface.Contacts), len(iface.Residues1), len(iface.Residues2), iface.BuriedArea, len(iface.HBonds), len(iface.SaltBridges)))
+	}
+	sb.WriteString("chain1\tresidue1\tnumber1\tchain2\tresidue2\tnumber2\tdistance\ttype\thbonds\tsalt_bridges\n")
+	for _, iface := range interfaces {
+		for _, c := range iface.Contacts {
+			sb.WriteString(fmt.Sprintf("%s\t%s\t%d%s\t%s\t%s\t%d%s\t%.2f\t%s\t%d\t%d\n",
+				c.Res1.chain, c.Res1.amino, c.Res1.resSeq, c.Res1.iCode, c.Res2.chain, c.Res2.amino, c.Res2.resSeq, c.Res2.iCode,
+				c.Distance, c.Type, c.HBonds, c.SaltBridges))
+		}
+	}
+	return sb.String()
+}
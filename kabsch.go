@@ -1,12 +1,35 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"math"
+	"os"
+	"strconv"
+	"strings"
 
 	"gonum.org/v1/gonum/mat"
 )
 
+// atomicMasses holds the masses (in daltons) of the elements found in proteins
+var atomicMasses = map[string]float64{
+	"H":  1.008,
+	"C":  12.011,
+	"N":  14.007,
+	"O":  15.999,
+	"S":  32.06,
+	"P":  30.974,
+	"SE": 78.971,
+}
+
+// Superposition is the result of fitting mobile atoms onto fixed atoms
+type Superposition struct {
+	Transform  Transform // moves the mobile atoms onto the fixed atoms
+	RMSD       float64   // weighted RMSD over all pairs (plain RMSD with uniform weights)
+	Deviations []float64 // distance of every pair after the fit
+	Weights    []float64 // weight of every pair used in the fit
+}
+
 // RunKabsch takes as input two slices of atoms pointers and returns the rotated versions of these atoms slices
 // such that the RMSD is minimized
 func RunKabsch(samp1, samp2 []*Atom) ([]*Atom, []*Atom, float64) {
@@ -47,10 +70,6 @@ func kabsch(p, q *mat.Dense) (*mat.Dense, *mat.Dense, float64) {
 	var h mat.Dense
 	h.Mul(b.T(), a)
 
-	fmt.Println("Covariance matrix h: ")
-
-	matPrint(&h)
-
 	var svd mat.SVD
 	if ok := svd.Factorize(&h, mat.SVDFull); !ok {
 		fmt.Println("SVD failed")
@@ -62,15 +81,9 @@ func kabsch(p, q *mat.Dense) (*mat.Dense, *mat.Dense, float64) {
 	var U mat.Dense
 	svd.UTo(&U)
 
-	fmt.Println("SVD U matrix: ")
-	matPrint(&U)
-
 	var VT mat.Dense
 	svd.VTo(&VT)
 
-	fmt.Println("SVD VT: ")
-	matPrint(VT.T())
-
 	reflect := mat.Det(&U) * mat.Det(VT.T())
 	if reflect < 0 {
 		S[len(S)-1] = -S[len(S)-1]
@@ -81,8 +94,6 @@ func kabsch(p, q *mat.Dense) (*mat.Dense, *mat.Dense, float64) {
 		}
 	}
 
-	fmt.Println("Reflect value: ", reflect)
-
 	RMSD := E0 - 2*mat.Sum(mat.NewVecDense(len(S), S))
 	RMSD = math.Sqrt(math.Abs(RMSD / float64(a.RawMatrix().Rows)))
 
@@ -140,10 +151,18 @@ func GenerateAtomSlice(matrix *mat.Dense, pdbInfo []*Atom) []*Atom {
 			amino:    pdbInfo[i].amino,
 			chain:    pdbInfo[i].chain,
 			seqIndex: pdbInfo[i].seqIndex,
+			resSeq:   pdbInfo[i].resSeq,
+			iCode:    pdbInfo[i].iCode,
+			symbol:   pdbInfo[i].symbol,
+			bFactor:  pdbInfo[i].bFactor,
 			x:        matrix.At(i, 0),
 			y:        matrix.At(i, 1),
 			z:        matrix.At(i, 2),
 			radius:   pdbInfo[i].radius,
+			model:    pdbInfo[i].model,
+			rmsf:     pdbInfo[i].rmsf,
+
+			interfaceRes: pdbInfo[i].interfaceRes,
 		}
 	}
 
@@ -200,8 +219,92 @@ func CopyMatrix(a *mat.Dense) *mat.Dense {
 	return newMat
 }
 
-// matPrint takes as input a matrix and prints it
-func matPrint(X mat.Matrix) {
-	fa := mat.Formatted(X, mat.Prefix(""), mat.Squeeze())
-	fmt.Printf("%v\n", fa)
+// SuperposeAtoms takes as input two equally long slices of paired atoms and per-pair weights (nil for uniform)
+// and returns the transform that moves the mobile atoms onto the fixed atoms together with the weighted RMSD and
+// the deviation of every pair; the transform can be applied to any other atoms with Transform.ApplyToAtoms
+func SuperposeAtoms(fixed, mobile []*Atom, weights []float64) Superposition {
+	if weights == nil {
+		weights = make([]float64, len(fixed))
+		for i := range weights {
+			weights[i] = 1.0
+		}
+	}
+	t, _ := QCPSuperpose(AtomCoordinates(fixed), AtomCoordinates(mobile), weights)
+	return SuperposeAtomsWith(fixed, mobile, weights, t)
+}
+
+// PairWeights returns one weight per atom pair using the given scheme: "uniform", "mass" (mean atomic mass of
+// the pair), "bfactor" (inverse of the mean B-factor, so that mobile atoms count less) or the path of a file
+// with one user specified weight per line
+func PairWeights(fixed, mobile []*Atom, scheme string) ([]float64, error) {
+	weights := make([]float64, len(fixed))
+	switch scheme {
+	case "", "uniform":
+		for i := range weights {
+			weights[i] = 1.0
+		}
+	case "mass":
+		for i := range weights {
+			weights[i] = (atomMass(fixed[i]) + atomMass(mobile[i])) / 2
+		}
+	case "bfactor":
+		for i := range weights {
+			b := (fixed[i].bFactor + mobile[i].bFactor) / 2
+			weights[i] = 1.0 / math.Max(b, 1.0)
+		}
+	default:
+		userWeights, err := ReadWeights(scheme)
+		if err != nil {
+			return nil, err
+		}
+		if len(userWeights) != len(fixed) {
+			return nil, fmt.Errorf("%s has %d weights but there are %d atom pairs", scheme, len(userWeights), len(fixed))
+		}
+		weights = userWeights
+	}
+	return weights, nil
+}
+
+// ReadWeights reads one non-negative weight per line from a file, ignoring blank lines and lines starting with #
+func ReadWeights(path string) ([]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	weights := make([]float64, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		w, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			return nil, err
+		}
+		if w < 0 {
+			return nil, fmt.Errorf("%s: negative weight %v", path, w)
+		}
+		weights = append(weights, w)
+	}
+	return weights, scanner.Err()
+}
+
+// atomMass returns the mass of an atom's element, treating unknown elements as carbon
+func atomMass(atom *Atom) float64 {
+	if mass, ok := atomicMasses[strings.ToUpper(atom.symbol)]; ok {
+		return mass
+	}
+	return atomicMasses["C"]
+}
+
+// PrintSuperposition prints the transform, RMSD and the largest pair deviations of a superposition
+func PrintSuperposition(result Superposition) {
+	PrintTransform(result.Transform)
+	largest := 0.0
+	for _, d := range result.Deviations {
+		largest = math.Max(largest, d)
+	}
+	fmt.Printf("Weighted RMSD: %.3f over %d pairs (largest deviation %.3f)\n\n", result.RMSD, len(result.Deviations), largest)
 }
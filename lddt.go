@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// parameters of the local distance difference test
+var lddtThresholds = []float64{0.5, 1, 2, 4} // distance differences in angstroms counted as preserved
+
+const (
+	lddtInclusionRadius = 15.0 // reference distances up to this length are scored
+	lddtBondTolerance   = 0.4  // allowed deviation of a bond length in the model in angstroms
+	lddtClashTolerance  = 1.5  // allowed overlap of van der Waals radii before two atoms clash
+	lddtNCABond         = 1.458
+	lddtCACAMin         = 2.7 // shortest CA-CA distance of consecutive residues (cis peptide with tolerance)
+	lddtCACAMax         = 4.2 // longest CA-CA distance of consecutive residues (trans peptide with tolerance)
+)
+
+// LDDTResult is the local distance difference test of a model against a reference structure
+type LDDTResult struct {
+	Global     float64    // fraction of preserved reference distances over all thresholds
+	Residues   []*Residue // reference residues with at least one scored distance
+	PerResidue []float64  // lDDT of every residue in Residues
+	Violations []*Residue // model residues that failed the stereochemistry checks
+}
+
+// LDDT scores structure 2 of the correspondence (the model) against structure 1 (the reference) without
+// superposition: every distance between atoms of different reference residues shorter than the inclusion radius
+// is preserved at a threshold when the model distance differs by less than the threshold
+// with caOnly only alpha carbons are scored, otherwise all atoms matched by name with symmetric side chain atoms
+// resolved; reference atoms without a partner and atoms of model residues failing the stereochemistry checks
+// never count as preserved
+func LDDT(correspondences []ResidueCorrespondence, caOnly bool) LDDTResult {
+	// reference atoms and their model partners, nil where the model lacks the atom
+	refAtoms, modelAtoms := []*Atom{}, []*Atom{}
+	residueIndex := []int{}
+	residues := []*Residue{}
+	for _, c := range correspondences {
+		if c.Res1 == nil {
+			continue
+		}
+		var names map[string]string
+		if c.Res2 != nil {
+			names = SymmetricNames(c.Res1, c.Res2)
+		}
+		for _, atom := range c.Res1.atoms {
+			if caOnly && atom.element != "CA" {
+				continue
+			}
+			var partner *Atom
+			if c.Res2 != nil {
+				name := atom.element
+				if swapped, ok := names[name]; ok {
+					name = swapped
+				}
+				partner = residueAtom(c.Res2, name)
+			}
+			refAtoms = append(refAtoms, atom)
+			modelAtoms = append(modelAtoms, partner)
+			residueIndex = append(residueIndex, len(residues))
+		}
+		residues = append(residues, c.Res1)
+	}
+
+	violations := StereochemistryViolations(modelAtoms)
+	pairs, refDists := ContactPairs(refAtoms, lddtInclusionRadius)
+
+	preserved := make([]int, len(residues))
+	total := make([]int, len(residues))
+	for p, pair := range pairs {
+		i, j := pair[0], pair[1]
+		if residueIndex[i] == residueIndex[j] {
+			continue
+		}
+		count := 0
+		if modelAtoms[i] != nil && modelAtoms[j] != nil && !violations[modelAtoms[i].seqIndex] && !violations[modelAtoms[j].seqIndex] {
+			delta := math.Abs(Distance(modelAtoms[i], modelAtoms[j]) - refDists[p])
+			for _, threshold := range lddtThresholds {
+				if delta < threshold {
+					count++
+				}
+			}
+		}
+		for _, r := range []int{residueIndex[i], residueIndex[j]} {
+			preserved[r] += count
+			total[r] += len(lddtThresholds)
+		}
+	}
+
+	result := LDDTResult{}
+	sumPreserved, sumTotal := 0, 0
+	for r, res := range residues {
+		if total[r] == 0 {
+			continue
+		}
+		result.Residues = append(result.Residues, res)
+		result.PerResidue = append(result.PerResidue, float64(preserved[r])/float64(total[r]))
+		sumPreserved += preserved[r]
+		sumTotal += total[r]
+	}
+	if sumTotal > 0 {
+		// every distance was counted once for each of its two residues
+		result.Global = float64(sumPreserved) / float64(sumTotal)
+	}
+	for _, c := range correspondences {
+		if c.Res2 != nil && violations[c.Res2.seqIndex] {
+			result.Violations = append(result.Violations, c.Res2)
+		}
+	}
+	return result
+}
+
+// StereochemistryViolations checks bond lengths and clashes among a slice of atoms (nil entries are skipped)
+// and returns the residue indices (seqIndex) of the residues involved in a violation
+// bonds checked are N-CA within a residue and the CA-CA distance of consecutive residues of a chain;
+// a clash is two atoms of non-neighbouring residues of one model (other than two cysteine sulfurs) closer than
+// their van der Waals radii minus a tolerance
+func StereochemistryViolations(atoms []*Atom) map[int]bool {
+	violations := make(map[int]bool)
+	present := make([]*Atom, 0, len(atoms))
+	for _, atom := range atoms {
+		if atom != nil {
+			present = append(present, atom)
+		}
+	}
+
+	// bonds within a residue and between consecutive residues
+	alphaCarbons := make(map[int]*Atom)
+	nitrogens := make(map[int]*Atom)
+	for _, atom := range present {
+		if atom.element == "CA" {
+			alphaCarbons[atom.seqIndex] = atom
+		} else if atom.element == "N" {
+			nitrogens[atom.seqIndex] = atom
+		}
+	}
+	for index, ca := range alphaCarbons {
+		if n, ok := nitrogens[index]; ok {
+			if d := Distance(n, ca); d < lddtNCABond-lddtBondTolerance || d > lddtNCABond+lddtBondTolerance {
+				violations[index] = true
+			}
+		}
+		next, ok := alphaCarbons[index+1]
+		if ok && next.chain == ca.chain && next.resSeq-ca.resSeq == 1 {
+			if d := Distance(ca, next); d < lddtCACAMin || d > lddtCACAMax {
+				violations[index] = true
+				violations[index+1] = true
+			}
+		}
+	}
+
+	// clashes can only occur within twice the largest radius (sulfur, 1.8 angstroms)
+	reach := 2*1.8 - lddtClashTolerance
+	for _, pair := range NewAtomIndex(present, reach).Pairs(reach) {
+		a, b := present[pair[0]], present[pair[1]]
+		separation := b.seqIndex - a.seqIndex
+		if separation < 0 {
+			separation = -separation
+		}
+		if (separation <= 1 && a.chain == b.chain) || (a.element == "SG" && b.element == "SG") || a.model != b.model {
+			// bonded neighbours, cysteines that may be bonded by a disulfide, or atoms of different models
+			continue
+		}
+		if Distance(a, b) < vanDerWaalsRadius(a)+vanDerWaalsRadius(b)-lddtClashTolerance {
+			violations[a.seqIndex] = true
+			violations[b.seqIndex] = true
+		}
+	}
+	return violations
+}
+
+// vanDerWaalsRadius returns the radius of an atom, taking carbon's for atoms parsed without one
+func vanDerWaalsRadius(atom *Atom) float64 {
+	if atom.radius == 0 {
+		return 1.7
+	}
+	return atom.radius
+}
+
+// PrintLDDT prints the global lDDT followed by one line per scored residue
+func PrintLDDT(result LDDTResult, caOnly bool) {
+	variant := "all-atom"
+	if caOnly {
+		variant = "CA-only"
+	}
+	fmt.Printf("lDDT (%s): %.4f over %d residues, %d model residues with stereochemical violations\n", variant, result.Global, len(result.Residues), len(result.Violations))
+	for i, res := range result.Residues {
+		fmt.Printf("  %s %s %d%s %.4f\n", res.chain, res.amino, res.resSeq, res.iCode, result.PerResidue[i])
+	}
+	fmt.Println()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// identicalCorrespondences pairs every residue of two parses of the same structure
+func identicalCorrespondences(atoms1, atoms2 []*Atom) []ResidueCorrespondence {
+	sequence := GetQuerySequence(atoms1)
+	return ResidueCorrespondences(sequence, sequence, Residues(atoms1), Residues(atoms2))
+}
+
+func TestLDDT(t *testing.T) {
+	reference := ParsePDB("pdbfiles/1mbn.pdb")
+	rotated := Transform{Rotation: [3][3]float64{{0, 0, 1}, {1, 0, 0}, {0, 1, 0}}, Translation: vec3{5, 5, 5}}.ApplyToAtoms(reference)
+	for _, caOnly := range []bool{true, false} {
+		result := LDDT(identicalCorrespondences(reference, rotated), caOnly)
+		if math.Abs(result.Global-1) > 1e-12 || len(result.Violations) != 0 {
+			t.Errorf("LDDT of a rotated copy of 1mbn (caOnly %v) = %v with %d violations, want 1 and none", caOnly, result.Global, len(result.Violations))
+		}
+	}
+
+	// moving one residue by 0.75 angstroms keeps its bonds but breaks its distances at the 0.5 threshold
+	model := ParsePDB("pdbfiles/1mbn.pdb")
+	moved := Residues(model)[50]
+	for _, atom := range moved.atoms {
+		atom.x += 0.75
+	}
+	result := LDDT(identicalCorrespondences(reference, model), false)
+	if len(result.Violations) != 0 {
+		t.Errorf("LDDT flagged %d residues after a small move, want none", len(result.Violations))
+	}
+	for i, res := range result.Residues {
+		score := result.PerResidue[i]
+		if res.seqIndex == moved.seqIndex && (score < 0.75 || score >= 1) {
+			t.Errorf("lDDT of the moved residue = %v, want at least 0.75 and below 1", score)
+		}
+		if res.seqIndex != moved.seqIndex && score < 0.75 {
+			t.Errorf("lDDT of residue %d = %v, only its distances to the moved residue may change", res.resSeq, score)
+		}
+	}
+	if result.Global >= 1 || result.Global < 0.99 {
+		t.Errorf("LDDT after moving one residue = %v, want just below 1", result.Global)
+	}
+
+	// a residue pulled away from its neighbours fails the CA-CA check and none of its distances count
+	far := ParsePDB("pdbfiles/1mbn.pdb")
+	pulled := Residues(far)[50]
+	for _, atom := range pulled.atoms {
+		atom.x += 3
+	}
+	result = LDDT(identicalCorrespondences(reference, far), true)
+	flagged := false
+	for _, res := range result.Violations {
+		flagged = flagged || res.seqIndex == pulled.seqIndex
+	}
+	if !flagged {
+		t.Errorf("LDDT did not flag the residue pulled 3 angstroms away")
+	}
+	for i, res := range result.Residues {
+		if res.seqIndex == pulled.seqIndex && result.PerResidue[i] != 0 {
+			t.Errorf("lDDT of the pulled residue = %v, want 0", result.PerResidue[i])
+		}
+	}
+}
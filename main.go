@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"math"
@@ -12,6 +13,47 @@ import (
 	"github.com/go-gl/glfw/v3.3/glfw"
 )
 
+// command line options, the remaining arguments are PDB IDs
+var (
+	msaMode     = flag.Bool("msa", false, "progressively align all given PDB IDs instead of comparing two")
+	treeMethod  = flag.String("tree", "upgma", "guide tree method for -msa: upgma or nj")
+	outFormat   = flag.String("format", "result", "alignment output format: result (result.txt for app.py), fasta, clustal, stockholm or emboss; the qRes scores of result and stockholm only count residue pairs within 10 angstroms in either structure, unlike the all-pairs definition")
+	shuffles    = flag.Int("shuffles", 0, "estimate the significance of the alignment score from this many shuffled alignments, 200 is typical (0 skips it)")
+	outFile     = flag.String("out", "", "alignment output file, defaults to alignment.<ext> for the chosen format")
+	alignFile   = flag.String("alignment", "", "pairwise alignment (FASTA or Clustal) to use instead of Needleman-Wunsch")
+	mappingFile = flag.String("mapping", "", "write the residue correspondence table to this file (.json for JSON, otherwise TSV)")
+	structural  = flag.Bool("structural", false, "align by structure (TM-align style) instead of by sequence")
+	ssMode      = flag.Bool("ss", false, "use secondary structure (HELIX/SHEET records or computed) in sequence alignment scoring")
+	weightMode  = flag.String("weights", "uniform", "superposition weights: uniform, mass, bfactor or a file with one weight per atom pair")
+	coreMode    = flag.Bool("core", false, "also fit the structural core by iteratively rejecting outlying pairs")
+	coreCutoff  = flag.Float64("core-cutoff", 0, "core fitting: reject pairs deviating more than this many angstroms (0 uses -core-sigma)")
+	coreSigma   = flag.Float64("core-sigma", 2.0, "core fitting: reject pairs deviating more than this multiple of the core RMSD")
+	lddtMode    = flag.String("lddt", "", "score structure 2 against structure 1 with lDDT using \"ca\" or \"all\" atoms")
+	allMode     = flag.Bool("all", false, "compare every pair of the given PDB IDs and cluster them instead of comparing two")
+	linkage     = flag.String("linkage", "average", "linkage for -all clustering: single, average or complete")
+	metric      = flag.String("metric", "rmsd", "distance for -all clustering: rmsd, tm or identity")
+	numWorkers  = flag.Int("workers", runtime.NumCPU(), "number of concurrent pairwise comparisons for -all")
+	ensemble    = flag.Bool("ensemble", false, "analyze the models of the first PDB ID (RMSF, average and medoid) instead of comparing two")
+	refModel    = flag.Int("ref-model", 0, "0-based index of the reference model for -ensemble")
+	meanFit     = flag.Bool("mean-fit", false, "with -ensemble, superpose iteratively onto the mean instead of the reference model")
+	flexible    = flag.Bool("flexible", false, "also split the alignment into rigid fragments separated by hinges")
+	hingeCost   = flag.Float64("hinge-penalty", 100, "flexible alignment: cost of a hinge in square angstroms of summed deviation")
+	minFragment = flag.Int("min-fragment", 10, "flexible alignment: fewest residue pairs in a rigid fragment")
+	atomSet     = flag.String("atoms", "backbone", "atoms used for superposition and RMSD: ca, backbone (N, CA, C, O), cb or heavy")
+	symmetric   = flag.Bool("symmetry", false, "also report the smallest RMSD over chain permutations of identical chains")
+	qMode       = flag.String("q", "", "score native contacts of structure 1 in structure 2 using \"ca\", \"cb\" or \"heavy\" contacts")
+	qCutoff     = flag.Float64("q-cutoff", 0, "native contact cutoff in angstroms (0 uses 8 for ca/cb and 4.5 for heavy)")
+	qSeparation = flag.Int("q-separation", 3, "smallest sequence separation of a native contact")
+	qExponent   = flag.Float64("q-exponent", 0.15, "contact width sigma = |i-j|^exponent within a chain")
+	contactMaps = flag.Bool("contact-maps", false, "write the CA distance maps and their difference as CSV, NPY and PNG heatmaps")
+	interfaces  = flag.Bool("interface", false, "analyze the interfaces between the chains of both structures (press 6 to highlight them)")
+	ifaceCutoff = flag.Float64("interface-cutoff", interfaceCutoff, "closest heavy atom distance in angstroms of two residues in contact across chains")
+	dockQ       = flag.Bool("dockq", false, "compare the chain interfaces of structure 2 with those of reference structure 1 (Fnat, iRMSD, LRMSD, DockQ), requires -chains")
+	interacts   = flag.Bool("interactions", false, "detect hydrogen bonds, salt bridges, disulfides and aromatic interactions in both structures (press 7 to toggle their lines)")
+	dsspMode    = flag.Bool("dssp", false, "assign secondary structure to both structures with DSSP and compare it along the alignment")
+	chainMode   = flag.Bool("chains", false, "align chain by chain, pairing the chains of the two structures optimally")
+)
+
 func init() {
 	runtime.LockOSThread()
 }
@@ -21,19 +63,43 @@ func main() {
 	numProcs := runtime.NumCPU()
 	runtime.GOMAXPROCS(numProcs)
 
-	// DOWNLOAD PDB FILES
-	pdbURL := "https://files.rcsb.org/download/" + os.Args[1] + ".pdb"
-	localPath := "pdbfiles/" + os.Args[1] + ".pdb"
-	err := downloadPDB(pdbURL, localPath)
-	if err != nil {
-		fmt.Println("Error downloading PDB file:", err)
+	flag.Parse()
+	pdbIDs := flag.Args()
+	if len(pdbIDs) < 2 && !(*ensemble && len(pdbIDs) == 1) {
+		fmt.Println("Usage: GoMol [options] PDB_ID_1 PDB_ID_2 [PDB_ID ...]")
+		flag.PrintDefaults()
+		os.Exit(1)
 	}
-	pdbURL = "https://files.rcsb.org/download/" + os.Args[2] + ".pdb"
-	localPath = "pdbfiles/" + os.Args[2] + ".pdb"
-	err = downloadPDB(pdbURL, localPath)
-	if err != nil {
-		fmt.Println("Error downloading PDB file:", err)
+
+	// load the BLOSUM62 substitution matrix used for alignment scoring
+	if err := ReadBLOSUM62(); err != nil {
+		log.Fatal(err)
+	}
+	if err := ValidateAtomSet(*atomSet); err != nil {
+		log.Fatal(err)
+	}
+	// chain mode replaces the other alignment modes, and interfaces are compared between its chain pairs
+	if err := ValidateChainMode(*alignFile, *structural, *ssMode, *chainMode, *dockQ); err != nil {
+		log.Fatal(err)
+	}
+
+	// multiple structure mode runs without opening a window
+	if *msaMode {
+		RunMSA(pdbIDs, *treeMethod, *outFormat, *outFile, numProcs)
+		return
+	}
+	if *ensemble {
+		RunEnsemble(pdbIDs[0], *refModel, *meanFit)
+		return
 	}
+	if *allMode {
+		RunAllVsAll(pdbIDs, *metric, *linkage, *numWorkers)
+		return
+	}
+
+	// DOWNLOAD PDB FILES
+	pdbFile1 := FetchPDB(pdbIDs[0])
+	pdbFile2 := FetchPDB(pdbIDs[1])
 
 	// Initialize GLFW and create a window
 	if err := glfw.Init(); err != nil {
@@ -57,20 +123,99 @@ func main() {
 	gl.Viewport(0, 0, imageWidth, imageHeight)
 
 	// parse pdb file to get list of atom objects
-	atoms1 = ParsePDB("pdbfiles/" + os.Args[1] + ".pdb")
-	atoms2 = ParsePDB("pdbfiles/" + os.Args[2] + ".pdb")
+	atoms1 = ParsePDB(pdbFile1)
+	atoms2 = ParsePDB(pdbFile2)
+
+	// ensembles such as NMR structures can be colored by the fluctuation of their residues
+	for _, atoms := range [][]*Atom{atoms1, atoms2} {
+		if len(SplitModels(atoms)) < 2 {
+			continue
+		}
+		rmsf, err := AssignRMSF(atoms)
+		if err != nil {
+			log.Printf("no RMSF coloring: %v", err)
+			continue
+		}
+		maxRMSF = math.Max(maxRMSF, rmsf)
+	}
 
 	// get amino acid sequences from atom slices
 	atoms1_sequence = GetQuerySequence(atoms1)
 	atoms2_sequence = GetQuerySequence(atoms2)
 
-	// perform Needleman-Wunsch algorithm to get aligned sequences and percent similarity
-	alignedSeq1, alignedSeq2, matchLine, percentSimilarity = NeedlemanWunsch(atoms1_sequence, atoms2_sequence)
-	fmt.Println(alignedSeq1)
-	fmt.Println(matchLine)
-	fmt.Println(alignedSeq2)
+	// the sequences covered by the alignment, in chain mode only the paired chains in pair order
+	sequence1, sequence2 := atoms1_sequence, atoms2_sequence
+	var chainPairs []ChainPair
+	if *alignFile != "" {
+		// use the user supplied alignment after checking it against the structures' sequences
+		names, rows, err := ReadAlignment(*alignFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		alignedSeq1, alignedSeq2, err = SelectAlignmentRows(names, rows, pdbIDs[0], pdbIDs[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		mismatches := append(ValidateAlignmentRow(pdbIDs[0], alignedSeq1, atoms1_sequence), ValidateAlignmentRow(pdbIDs[1], alignedSeq2, atoms2_sequence)...)
+		if len(mismatches) > 0 {
+			for _, mismatch := range mismatches {
+				fmt.Println(mismatch)
+			}
+			log.Fatalf("alignment %s does not match the structure sequences", *alignFile)
+		}
+		matchLine = MatchLine(alignedSeq1, alignedSeq2)
+		percentSimilarity = AlignmentStatistics(atoms1_sequence, atoms2_sequence, alignedSeq1, alignedSeq2).IdentityAligned
+		fmt.Println(alignedSeq1)
+		fmt.Println(matchLine)
+		fmt.Println(alignedSeq2)
+		fmt.Printf("The percent identity of the two sequences in %s is %.2f%%\n\n", *alignFile, percentSimilarity)
+	} else if *structural {
+		// sequence independent alignment from iterated superposition and dynamic programming
+		structuralAlignment := TMAlign(atoms1, atoms2)
+		PrintStructuralAlignment(structuralAlignment)
+		alignedSeq1, alignedSeq2 = structuralAlignment.Align1, structuralAlignment.Align2
+		matchLine = MatchLine(alignedSeq1, alignedSeq2)
+		percentSimilarity = AlignmentStatistics(atoms1_sequence, atoms2_sequence, alignedSeq1, alignedSeq2).IdentityAligned
+		fmt.Printf("The percent identity of the structurally aligned sequences is %.2f%%\n\n", percentSimilarity)
+	} else if *ssMode {
+		// secondary structure bonus and raised gap penalties inside helices and strands
+		ss1 := SecondaryStructure(pdbFile1, atoms1)
+		ss2 := SecondaryStructure(pdbFile2, atoms2)
+		gaps1 := PositionGapPenalties(ss1, ssGapOutside, ssGapInside)
+		gaps2 := PositionGapPenalties(ss2, ssGapOutside, ssGapInside)
+		alignedSeq1, alignedSeq2, matchLine, percentSimilarity = NeedlemanWunschSS(atoms1_sequence, atoms2_sequence, ss1, ss2, gaps1, gaps2, ssMatchBonus)
+		fmt.Println(string(ss1))
+		fmt.Println(string(ss2))
+		fmt.Println(alignedSeq1)
+		fmt.Println(matchLine)
+		fmt.Println(alignedSeq2)
+		fmt.Printf("The percent identity of the two sequences using secondary structure aware alignment is %.2f%%\n\n", percentSimilarity)
+	} else if *chainMode {
+		// align every chain to its optimally assigned partner and join the chain alignments
+		chainPairs = PairChains(atoms1, atoms2, numProcs)
+		PrintChainPairs(chainPairs)
+		alignedSeq1, alignedSeq2 = ComplexAlignment(chainPairs)
+		sequence1, sequence2 = ComplexSequences(chainPairs)
+		matchLine = MatchLine(alignedSeq1, alignedSeq2)
+		percentSimilarity = AlignmentStatistics(sequence1, sequence2, alignedSeq1, alignedSeq2).IdentityAligned
+		fmt.Println(alignedSeq1)
+		fmt.Println(matchLine)
+		fmt.Println(alignedSeq2)
+		fmt.Printf("The percent identity of the paired chains is %.2f%%\n\n", percentSimilarity)
+	} else {
+		// perform Needleman-Wunsch algorithm to get aligned sequences and percent similarity
+		alignedSeq1, alignedSeq2, matchLine, percentSimilarity = NeedlemanWunsch(atoms1_sequence, atoms2_sequence)
+		fmt.Println(alignedSeq1)
+		fmt.Println(matchLine)
+		fmt.Println(alignedSeq2)
+
+		fmt.Printf("The percent identity of the two sequences using Needleman-Wunsch is %.2f%%\n\n", percentSimilarity)
+	}
 
-	fmt.Printf("The percent identity of the two sequences using Needleman-Wunsch is %.2f%%\n\n", percentSimilarity)
+	// score, identity, gap and coverage statistics, plus significance from shuffled alignments on request
+	alignmentStats := AlignmentStatistics(sequence1, sequence2, alignedSeq1, alignedSeq2)
+	EstimateSignificance(&alignmentStats, sequence1, sequence2, *shuffles, numProcs)
+	PrintAlignmentStats(alignmentStats)
 
 	// initialize camera and light
 	// camera = InitializeCamera(atoms1)
@@ -89,38 +234,128 @@ func main() {
 	fmt.Println(len(atoms1_sequence))
 	fmt.Println(len(atoms2_sequence))
 
-	alignedAtoms1, alignedAtoms2 = FilterAlignedAtoms(atoms1_sequence, atoms2_sequence, alignedSeq1, alignedSeq2, atoms1, atoms2)
-	atoms1_sequence = GetQuerySequence(alignedAtoms1)
-
-	if len(atoms1) != len(atoms2) {
-		results1, results2, rmsd = RunKabsch(alignedAtoms1, alignedAtoms2)
+	if *chainMode {
+		alignedAtoms1, alignedAtoms2 = ComplexAlignedAtoms(chainPairs, *atomSet)
 	} else {
-		results1, results2, rmsd = RunKabsch(atoms1, atoms2)
+		alignedAtoms1, alignedAtoms2 = FilterAlignedAtoms(atoms1_sequence, atoms2_sequence, alignedSeq1, alignedSeq2, atoms1, atoms2, *atomSet)
 	}
+	atoms1_sequence = GetQuerySequence(alignedAtoms1)
+
+	// the alignment and the atom set define the atom pairs used for superposition
+	results1, results2, rmsd = RunKabsch(alignedAtoms1, alignedAtoms2)
 
 	resultsFinal = append(results1, results2...)
 
-	qRes := qRes(alignedAtoms1, alignedAtoms2)
+	// weighted fit reporting the full transformation and per-pair deviations
+	weights, err := PairWeights(alignedAtoms1, alignedAtoms2, *weightMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	superposition := SuperposeAtoms(alignedAtoms1, alignedAtoms2, weights)
+	PrintSuperposition(superposition)
+	if *coreMode {
+		PrintCoreFit(CoreSuperpose(alignedAtoms1, alignedAtoms2, weights, *coreCutoff, *coreSigma))
+	}
 
-	saveResultToFile(alignedSeq1, matchLine, alignedSeq2, qRes)
-	tempAtoms1 := make([]*Atom, len(atoms1))
-	copy(tempAtoms1, atoms1)
-	tempResults := make([]*Atom, 0)
+	if *symmetric {
+		PrintChainMapping(SymmetricRMSD(atoms1, atoms2, *atomSet, numProcs))
+	}
 
-	// only render alpha carbons for Kabsch for easier visualization
-	for _, val := range resultsFinal {
-		if val.element == "CA" {
-			tempResults = append(tempResults, val)
+	// TM-score, GDT and MaxSub of the residue correspondence, built chain pair by chain pair in chain mode
+	var correspondences []ResidueCorrespondence
+	if *chainMode {
+		correspondences = ComplexCorrespondences(chainPairs)
+	} else {
+		correspondences = ResidueCorrespondences(alignedSeq1, alignedSeq2, Residues(atoms1), Residues(atoms2))
+	}
+	PrintSimilarityScores(StructureSimilarity(correspondences, len(Residues(atoms1)), len(Residues(atoms2))))
+	if *flexible {
+		PrintFlexibleAlignment(FlexibleSuperpose(correspondences, *hingeCost, *minFragment))
+	}
+	if *qMode != "" {
+		options := QOptions{Contacts: *qMode, Cutoff: *qCutoff, MinSeparation: *qSeparation, Exponent: *qExponent}
+		q, err := NativeQ(correspondences, options)
+		if err != nil {
+			log.Fatal(err)
+		}
+		PrintNativeQ(q, options)
+	}
+	if *interfaces {
+		for i, atoms := range [][]*Atom{atoms1, atoms2} {
+			found := ChainInterfaces(atoms, *ifaceCutoff)
+			PrintInterfaces(pdbIDs[i], found)
+			if err := os.WriteFile("interface_"+pdbIDs[i]+".tsv", []byte(InterfaceTable(found)), 0644); err != nil {
+				log.Fatal(err)
+			}
+			MarkInterfaceAtoms(found)
+		}
+	}
+	if *dsspMode {
+		residues1, residues2 := Residues(atoms1), Residues(atoms2)
+		comparison := CompareSecondaryStructure(correspondences, residues1, residues2, DSSP(atoms1), DSSP(atoms2))
+		PrintSSComparison(comparison, alignedSeq1, alignedSeq2)
+	}
+	var dashes1, dashes2 []*Atom
+	if *interacts {
+		for i, atoms := range [][]*Atom{atoms1, atoms2} {
+			found := FindInteractions(atoms)
+			PrintInteractionCounts(pdbIDs[i], found)
+			if err := os.WriteFile("interactions_"+pdbIDs[i]+".tsv", []byte(InteractionTable(found)), 0644); err != nil {
+				log.Fatal(err)
+			}
+			if i == 0 {
+				dashes1 = InteractionDashes(found)
+			} else {
+				dashes2 = InteractionDashes(found)
+			}
 		}
 	}
+	if *dockQ {
+		PrintDockingScores(DockingComparison(correspondences))
+	}
+	if *contactMaps {
+		RunContactMaps(atoms1, atoms2, correspondences)
+	}
+	if *lddtMode != "" {
+		caOnly := *lddtMode == "ca"
+		PrintLDDT(LDDT(correspondences, caOnly), caOnly)
+	}
+
+	// qRes is a per-residue score, so compare the alpha carbons of the aligned residues
+	qRes := ColumnQRes(correspondences)
+
+	if *mappingFile != "" {
+		if err := SaveCorrespondences(*mappingFile, pdbIDs[0], pdbIDs[1], correspondences); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *outFormat == "result" {
+		saveResultToFile(alignedSeq1, matchLine, alignedSeq2, qRes)
+	} else {
+		names := []string{pdbIDs[0], pdbIDs[1]}
+		err := SaveAlignment(*outFormat, *outFile, names, []string{alignedSeq1, alignedSeq2}, &alignmentStats, qRes)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	// analysis keeps every heavy atom, rendering only the backbone and sulfur atoms with any interaction lines
+	tempAtoms1 := append(RenderedAtoms(atoms1), dashes1...)
+	tempAtoms2 := append(RenderedAtoms(atoms2), dashes2...)
+
+	// only render alpha carbons for Kabsch for easier visualization, unless the atom set has none
+	tempResults := AlphaCarbons(resultsFinal)
+	if len(tempResults) == 0 {
+		tempResults = resultsFinal
+	}
 	fmt.Println("RMSD from Kabsch algorithm: ", rmsd)
 
-	camera = InitializeCamera(atoms1)
+	camera = InitializeCamera(tempAtoms1)
 
 	// main rendering loop, which handles atom rotation, parallel ray tracing, drawing pixels buffer, and changing between rendering options
 	for !window.ShouldClose() {
 		if renderProtein2 {
-			atoms1 = atoms2
+			atoms1 = tempAtoms2
 		} else if renderKabsch {
 			atoms1 = tempResults
 		} else {
@@ -151,10 +386,13 @@ func mouseButtonCallback(w *glfw.Window, button glfw.MouseButton, action glfw.Ac
 	}
 }
 
+// saveResultToFile writes the alignment and the qRes scores of the scored columns to result.txt for app.py
 func saveResultToFile(alignedSeq1, matchLine, alignedSeq2 string, qRes []float64) {
-	qResStr := make([]string, len(qRes))
-	for i, score := range qRes {
-		qResStr[i] = fmt.Sprintf("%.2f", score) // Format to two decimal places
+	qResStr := make([]string, 0, len(qRes))
+	for _, score := range qRes {
+		if !math.IsNaN(score) {
+			qResStr = append(qResStr, fmt.Sprintf("%.2f", score)) // Format to two decimal places
+		}
 	}
 	qResLine := strings.Join(qResStr, " ")
 
@@ -202,18 +440,40 @@ func keyCallback(window *glfw.Window, key glfw.Key, scancode int, action glfw.Ac
 			colorByChain = true
 			colorByAtom = false
 			colorByDifferingRegions = false
+			colorByRMSF = false
+			colorByInterface = false
 		} else if key == glfw.Key2 && action == glfw.Press {
 			colorByChain = false
 			colorByAtom = true
 			colorByDifferingRegions = false
+			colorByRMSF = false
+			colorByInterface = false
 		} else if key == glfw.Key3 && action == glfw.Press {
 			colorByChain = false
 			colorByAtom = false
 			colorByDifferingRegions = true
+			colorByRMSF = false
+			colorByInterface = false
 		} else if key == glfw.Key4 && action == glfw.Press {
 			colorByChain = false
 			colorByAtom = false
 			colorByDifferingRegions = false
+			colorByRMSF = false
+			colorByInterface = false
+		} else if key == glfw.Key5 && action == glfw.Press {
+			colorByChain = false
+			colorByAtom = false
+			colorByDifferingRegions = false
+			colorByRMSF = true
+			colorByInterface = false
+		} else if key == glfw.Key6 && action == glfw.Press {
+			colorByChain = false
+			colorByAtom = false
+			colorByDifferingRegions = false
+			colorByRMSF = false
+			colorByInterface = true
+		} else if key == glfw.Key7 && action == glfw.Press {
+			showInteractions = !showInteractions
 		} else if key == glfw.KeyF1 && action == glfw.Press {
 			renderProtein1 = true
 			renderProtein2 = false
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+)
+
+// MultipleAlignment is the result of a progressive multiple sequence alignment
+type MultipleAlignment struct {
+	Names []string
+	Rows  []string // aligned sequences in input order
+	// ColumnMap[s][c] is the index of the residue of structure s in column c (as returned by Residues), or -1 for a gap
+	ColumnMap [][]int
+	Tree      *GuideTreeNode
+}
+
+// GuideTreeNode is a node of the binary guide tree that determines the merge order of the progressive alignment
+type GuideTreeNode struct {
+	Left, Right *GuideTreeNode
+	Leaf        int     // index of the input sequence for leaves, -1 for internal nodes
+	Length      float64 // branch length to the parent node
+}
+
+// profile is a set of already aligned rows together with the input indices they belong to
+type profile struct {
+	members []int
+	rows    []string
+}
+
+// RunMSA downloads and parses every PDB ID, progressively aligns their sequences and prints the alignment,
+// writing the column to residue map to msa_columns.tsv and, unless format is "result", the alignment itself
+func RunMSA(pdbIDs []string, treeMethod, format, path string, numProcs int) {
+	allAtoms := make([][]*Atom, len(pdbIDs))
+	seqs := make([]string, len(pdbIDs))
+	for i, id := range pdbIDs {
+		allAtoms[i] = ParsePDB(FetchPDB(id))
+		seqs[i] = GetQuerySequence(allAtoms[i])
+	}
+
+	msa := ProgressiveAlignment(pdbIDs, seqs, treeMethod, numProcs)
+
+	fmt.Println("Guide tree:", Newick(msa.Tree, msa.Names))
+	for i, row := range msa.Rows {
+		fmt.Printf("%-8s %s\n", msa.Names[i], row)
+	}
+	fmt.Printf("%-8s %s\n\n", "", ConservationLine(msa.Rows))
+
+	err := os.WriteFile("msa_columns.tsv", []byte(ColumnMapTable(msa, allAtoms)), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if format != "result" {
+		if err := SaveAlignment(format, path, msa.Names, msa.Rows, nil, nil); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// ProgressiveAlignment aligns several sequences by building a distance matrix from pairwise
+// Needleman-Wunsch alignments, building a guide tree (treeMethod "upgma" or "nj") and merging
+// profiles in guide tree order
+func ProgressiveAlignment(names, seqs []string, treeMethod string, numProcs int) *MultipleAlignment {
+	if len(seqs) == 0 {
+		return &MultipleAlignment{}
+	}
+	dist := DistanceMatrix(seqs, numProcs)
+
+	var tree *GuideTreeNode
+	if treeMethod == "nj" {
+		tree = NeighborJoining(dist)
+	} else {
+		tree = UPGMA(dist)
+	}
+
+	merged := alignTree(tree, seqs)
+
+	// put the rows back into input order
+	rows := make([]string, len(seqs))
+	for k, member := range merged.members {
+		rows[member] = merged.rows[k]
+	}
+
+	return &MultipleAlignment{
+		Names:     names,
+		Rows:      rows,
+		ColumnMap: BuildColumnMap(rows),
+		Tree:      tree,
+	}
+}
+
+// DistanceMatrix returns a matrix of pairwise distances (1 - fraction identity over aligned columns)
+// where the pairwise alignments are split over numProcs goroutines
+func DistanceMatrix(seqs []string, numProcs int) [][]float64 {
+	n := len(seqs)
+	dist := make([][]float64, n)
+	for i := range dist {
+		dist[i] = make([]float64, n)
+	}
+	pairs := make([][2]int, 0, n*(n-1)/2)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			pairs = append(pairs, [2]int{i, j})
+		}
+	}
+	if numProcs < 1 {
+		numProcs = 1
+	}
+	finished := make(chan bool, numProcs)
+	for p := 0; p < numProcs; p++ {
+		start := p * len(pairs) / numProcs
+		end := (p + 1) * len(pairs) / numProcs
+		go func(start, end int) {
+			for _, pair := range pairs[start:end] {
+				i, j := pair[0], pair[1]
+				align1, align2, _, _ := NeedlemanWunsch(seqs[i], seqs[j])
+				stats := AlignmentStatistics(seqs[i], seqs[j], align1, align2)
+				d := 1 - stats.IdentityAligned/100
+				dist[i][j] = d
+				dist[j][i] = d
+			}
+			finished <- true
+		}(start, end)
+	}
+	for p := 0; p < numProcs; p++ {
+		<-finished
+	}
+	return dist
+}
+
+// UPGMA builds a rooted guide tree by repeatedly joining the two closest clusters
+// and averaging distances weighted by cluster size
+func UPGMA(dist [][]float64) *GuideTreeNode {
+	tree, _ := HierarchicalClustering(dist, "average")
+	return tree
+}
+
+// NeighborJoining builds a guide tree with the neighbor-joining method and roots it at the final join
+func NeighborJoining(dist [][]float64) *GuideTreeNode {
+	n := len(dist)
+	nodes := make([]*GuideTreeNode, n)
+	d := copyDistances(dist)
+	for i := range nodes {
+		nodes[i] = &GuideTreeNode{Leaf: i}
+	}
+	active := n
+	for active > 2 {
+		// net divergence of every active node
+		r := make([]float64, n)
+		for i := range nodes {
+			if nodes[i] == nil {
+				continue
+			}
+			for k := range nodes {
+				if nodes[k] != nil {
+					r[i] += d[i][k]
+				}
+			}
+		}
+		a, b := -1, -1
+		bestQ := math.Inf(1)
+		for i := range nodes {
+			for j := i + 1; j < n; j++ {
+				if nodes[i] == nil || nodes[j] == nil {
+					continue
+				}
+				q := float64(active-2)*d[i][j] - r[i] - r[j]
+				if q < bestQ {
+					bestQ, a, b = q, i, j
+				}
+			}
+		}
+		lengthA := d[a][b]/2 + (r[a]-r[b])/(2*float64(active-2))
+		nodes[a].Length = math.Max(0, lengthA)
+		nodes[b].Length = math.Max(0, d[a][b]-lengthA)
+		joined := &GuideTreeNode{Left: nodes[a], Right: nodes[b], Leaf: -1}
+		for k := range nodes {
+			if nodes[k] == nil || k == a || k == b {
+				continue
+			}
+			d[a][k] = (d[a][k] + d[b][k] - d[a][b]) / 2
+			d[k][a] = d[a][k]
+		}
+		nodes[a] = joined
+		nodes[b] = nil
+		active--
+	}
+	a, b := -1, -1
+	for i := range nodes {
+		if nodes[i] == nil {
+			continue
+		}
+		if a == -1 {
+			a = i
+		} else {
+			b = i
+		}
+	}
+	if b == -1 {
+		return nodes[a]
+	}
+	nodes[a].Length = d[a][b] / 2
+	nodes[b].Length = d[a][b] / 2
+	return &GuideTreeNode{Left: nodes[a], Right: nodes[b], Leaf: -1}
+}
+
+// Newick returns the guide tree in Newick format using names for the leaves
+func Newick(node *GuideTreeNode, names []string) string {
+	return newickNode(node, names) + ";"
+}
+
+// newickNode recursively writes a subtree in Newick format without the trailing semicolon
+func newickNode(node *GuideTreeNode, names []string) string {
+	if node == nil {
+		return ""
+	}
+	if node.Leaf >= 0 {
+		return fmt.Sprintf("%s:%.4f", names[node.Leaf], node.Length)
+	}
+	return fmt.Sprintf("(%s,%s):%.4f", newickNode(node.Left, names), newickNode(node.Right, names), node.Length)
+}
+
+// alignTree recursively aligns the profiles of the two children of a guide tree node
+func alignTree(node *GuideTreeNode, seqs []string) profile {
+	if node.Leaf >= 0 {
+		return profile{members: []int{node.Leaf}, rows: []string{seqs[node.Leaf]}}
+	}
+	return AlignProfiles(alignTree(node.Left, seqs), alignTree(node.Right, seqs))
+}
+
+// AlignProfiles performs Needleman-Wunsch between two profiles, scoring a pair of columns
+// by the average BLOSUM62 score over all residue pairs (pairs involving a gap score zero)
+func AlignProfiles(p1, p2 profile) profile {
+	m, n := len(p1.rows[0]), len(p2.rows[0])
+	dp := make([][]float64, m+1)
+	trace := make([][]byte, m+1)
+	for i := range dp {
+		dp[i] = make([]float64, n+1)
+		trace[i] = make([]byte, n+1)
+	}
+	for i := 1; i <= m; i++ {
+		dp[i][0] = float64(i * gapPenalty)
+		trace[i][0] = 'u'
+	}
+	for j := 1; j <= n; j++ {
+		dp[0][j] = float64(j * gapPenalty)
+		trace[0][j] = 'l'
+	}
+	for i := 1; i <= m; i++ {
+		for j := 1; j <= n; j++ {
+			match := dp[i-1][j-1] + columnScore(p1.rows, i-1, p2.rows, j-1)
+			delete := dp[i-1][j] + gapPenalty
+			insert := dp[i][j-1] + gapPenalty
+			dp[i][j], trace[i][j] = match, 'd'
+			if delete > dp[i][j] {
+				dp[i][j], trace[i][j] = delete, 'u'
+			}
+			if insert > dp[i][j] {
+				dp[i][j], trace[i][j] = insert, 'l'
+			}
+		}
+	}
+
+	// trace back, building every row in reverse
+	rows := make([][]byte, len(p1.rows)+len(p2.rows))
+	i, j := m, n
+	for i > 0 || j > 0 {
+		switch trace[i][j] {
+		case 'd':
+			i--
+			j--
+			appendColumn(rows, p1.rows, i, p2.rows, j)
+		case 'u':
+			i--
+			appendColumn(rows, p1.rows, i, p2.rows, -1)
+		default:
+			j--
+			appendColumn(rows, p1.rows, -1, p2.rows, j)
+		}
+	}
+
+	merged := profile{members: append(append([]int{}, p1.members...), p2.members...)}
+	for _, row := range rows {
+		for a, b := 0, len(row)-1; a < b; a, b = a+1, b-1 {
+			row[a], row[b] = row[b], row[a]
+		}
+		merged.rows = append(merged.rows, string(row))
+	}
+	return merged
+}
+
+// appendColumn appends column i of rows1 and column j of rows2 to the rows being built,
+// where an index of -1 inserts a gap into every row of that profile
+func appendColumn(rows [][]byte, rows1 []string, i int, rows2 []string, j int) {
+	for k, row := range rows1 {
+		if i < 0 {
+			rows[k] = append(rows[k], '-')
+		} else {
+			rows[k] = append(rows[k], row[i])
+		}
+	}
+	for k, row := range rows2 {
+		if j < 0 {
+			rows[len(rows1)+k] = append(rows[len(rows1)+k], '-')
+		} else {
+			rows[len(rows1)+k] = append(rows[len(rows1)+k], row[j])
+		}
+	}
+}
+
+// columnScore returns the average BLOSUM62 score between column i of rows1 and column j of rows2
+func columnScore(rows1 []string, i int, rows2 []string, j int) float64 {
+	total := 0
+	for _, a := range rows1 {
+		if a[i] == '-' {
+			continue
+		}
+		for _, b := range rows2 {
+			if b[j] == '-' {
+				continue
+			}
+			total += score(rune(a[i]), rune(b[j]))
+		}
+	}
+	return float64(total) / float64(len(rows1)*len(rows2))
+}
+
+// BuildColumnMap returns, for every aligned row, the sequence index of the residue in each column or -1 for a gap
+func BuildColumnMap(rows []string) [][]int {
+	columnMap := make([][]int, len(rows))
+	for s, row := range rows {
+		columnMap[s] = make([]int, len(row))
+		index := 0
+		for c := 0; c < len(row); c++ {
+			if row[c] == '-' {
+				columnMap[s][c] = -1
+			} else {
+				columnMap[s][c] = index
+				index++
+			}
+		}
+	}
+	return columnMap
+}
+
+// ConservationLine returns a line marking fully conserved columns with '*' and gapless columns with '.'
+func ConservationLine(rows []string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	line := make([]byte, len(rows[0]))
+	for c := range line {
+		line[c] = '*'
+		for _, row := range rows {
+			if row[c] == '-' {
+				line[c] = ' '
+				break
+			}
+			if row[c] != rows[0][c] {
+				line[c] = '.'
+			}
+		}
+	}
+	return string(line)
+}
+
+// ColumnMapTable returns the column map as a tab separated table with one line per alignment column
+// where each cell names the chain, residue name and PDB residue number of the structure or "-" for a gap
+func ColumnMapTable(msa *MultipleAlignment, allAtoms [][]*Atom) string {
+	var sb strings.Builder
+	sb.WriteString("column\t" + strings.Join(msa.Names, "\t") + "\n")
+	residues := make([][]Residue, len(allAtoms))
+	for s, atoms := range allAtoms {
+		residues[s] = Residues(atoms)
+	}
+	for c := 0; c < len(msa.Rows[0]); c++ {
+		sb.WriteString(fmt.Sprint(c + 1))
+		for s := range msa.Rows {
+			r := msa.ColumnMap[s][c]
+			if r < 0 {
+				sb.WriteString("\t-")
+			} else {
+				res := residues[s][r]
+				sb.WriteString(fmt.Sprintf("\t%s:%s%d%s", res.chain, res.amino, res.resSeq, res.iCode))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// copyDistances returns a copy of a distance matrix so that tree building can overwrite it
+func copyDistances(dist [][]float64) [][]float64 {
+	d := make([][]float64, len(dist))
+	for i := range dist {
+		d[i] = append([]float64{}, dist[i]...)
+	}
+	return d
+}
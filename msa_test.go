@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// treeDistances returns the path length between every pair of leaves of a tree
+func treeDistances(root *GuideTreeNode, n int) [][]float64 {
+	dist := squareMatrix(n)
+	// depths maps every leaf below a node to its distance from that node
+	var walk func(node *GuideTreeNode) map[int]float64
+	walk = func(node *GuideTreeNode) map[int]float64 {
+		if node.Leaf >= 0 {
+			return map[int]float64{node.Leaf: 0}
+		}
+		left, right := walk(node.Left), walk(node.Right)
+		for a, da := range left {
+			for b, db := range right {
+				dist[a][b] = da + node.Left.Length + db + node.Right.Length
+				dist[b][a] = dist[a][b]
+			}
+		}
+		depths := map[int]float64{}
+		for a, da := range left {
+			depths[a] = da + node.Left.Length
+		}
+		for b, db := range right {
+			depths[b] = db + node.Right.Length
+		}
+		return depths
+	}
+	walk(root)
+	return dist
+}
+
+func TestNeighborJoining(t *testing.T) {
+	// the additive distances of the tree ((A:2,B:3),(C:4,D:1)) with an internal branch of 5
+	dist := [][]float64{
+		{0, 5, 11, 8},
+		{5, 0, 12, 9},
+		{11, 12, 0, 5},
+		{8, 9, 5, 0},
+	}
+	names := []string{"A", "B", "C", "D"}
+	tree := NeighborJoining(dist)
+	want := "(((A:2.0000,B:3.0000):5.0000,C:4.0000):0.5000,D:0.5000):0.0000;"
+	if got := Newick(tree, names); got != want {
+		t.Errorf("Newick(NeighborJoining(dist)) = %s, want %s", got, want)
+	}
+	// neighbor joining recovers an additive tree exactly, so the path lengths give back the distances
+	got := treeDistances(tree, len(names))
+	for i := range dist {
+		for j := range dist {
+			if math.Abs(got[i][j]-dist[i][j]) > 1e-9 {
+				t.Errorf("tree distance between %s and %s = %v, want %v", names[i], names[j], got[i][j], dist[i][j])
+			}
+		}
+	}
+}
+
+func TestAlignProfiles(t *testing.T) {
+	if err := ReadBLOSUM62(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rows1, rows2 []string
+		want         []string
+	}{
+		{[]string{"MK-V", "MKLV"}, []string{"MKV"}, []string{"MK-V", "MKLV", "MK-V"}},
+		{[]string{"AW-GK", "A-YGK"}, []string{"AWGK"}, []string{"AW-GK", "A-YGK", "AW-GK"}},
+		{[]string{"HEAG-WC", "HEAGAWC"}, []string{"HEAWC"}, []string{"HEAG-WC", "HEAGAWC", "HEA--WC"}},
+		// a residue only the second profile has opens a new gap column in the first, next to the existing one
+		{[]string{"MK-WV", "MKLWV"}, []string{"MKLWHV"}, []string{"MK-W-V", "MKLW-V", "MKLWHV"}},
+	}
+	for _, test := range tests {
+		got := AlignProfiles(profile{members: []int{0, 1}, rows: test.rows1}, profile{members: []int{2}, rows: test.rows2})
+		if !reflect.DeepEqual(got.rows, test.want) {
+			t.Errorf("AlignProfiles(%q, %q) = %q, want %q", test.rows1, test.rows2, got.rows, test.want)
+		}
+		if !reflect.DeepEqual(got.members, []int{0, 1, 2}) {
+			t.Errorf("AlignProfiles(%q, %q) members = %v, want [0 1 2]", test.rows1, test.rows2, got.members)
+		}
+	}
+}
+
+func TestColumnMap(t *testing.T) {
+	rows := []string{"AC-D", "-CKD", "ACK-"}
+	want := [][]int{
+		{0, 1, -1, 2},
+		{-1, 0, 1, 2},
+		{0, 1, 2, -1},
+	}
+	columnMap := BuildColumnMap(rows)
+	if !reflect.DeepEqual(columnMap, want) {
+		t.Errorf("BuildColumnMap(%q) = %v, want %v", rows, columnMap, want)
+	}
+
+	// one alpha carbon per residue, numbered from first with the given insertion codes
+	structure := func(chain string, aminos []string, first int, iCodes []string) []*Atom {
+		atoms := []*Atom{}
+		for i, amino := range aminos {
+			atoms = append(atoms, &Atom{element: "CA", amino: amino, chain: chain, seqIndex: i, resSeq: first + i, iCode: iCodes[i]})
+		}
+		return atoms
+	}
+	allAtoms := [][]*Atom{
+		structure("A", []string{"ALA", "CYS", "ASP"}, 1, []string{"", "", ""}),
+		structure("B", []string{"CYS", "LYS", "ASP"}, 10, []string{"", "A", ""}),
+		structure("A", []string{"ALA", "CYS", "LYS"}, 5, []string{"", "", ""}),
+	}
+	msa := &MultipleAlignment{Names: []string{"s1", "s2", "s3"}, Rows: rows, ColumnMap: columnMap}
+	wantTable := strings.Join([]string{
+		"column\ts1\ts2\ts3",
+		"1\tA:ALA1\t-\tA:ALA5",
+		"2\tA:CYS2\tB:CYS10\tA:CYS6",
+		"3\t-\tB:LYS11A\tA:LYS7",
+		"4\tA:ASP3\tB:ASP12\t-",
+	}, "\n") + "\n"
+	if got := ColumnMapTable(msa, allAtoms); got != wantTable {
+		t.Errorf("ColumnMapTable() =\n%s\nwant\n%s", got, wantTable)
+	}
+}
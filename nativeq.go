@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// default native contact cutoffs in angstroms for residue-level and heavy-atom contact definitions, and the width
+// of a contact between chains, whose residue indices have no sequence separation
+const (
+	qResidueCutoff   = 8.0
+	qHeavyCutoff     = 4.5
+	qInterchainSigma = 2.0
+)
+
+// QOptions defines the native contacts and their tolerance for the Q score
+type QOptions struct {
+	Contacts      string  // ca, cb (CA for glycine) or heavy (closest heavy atoms of the two residues)
+	Cutoff        float64 // largest native distance of a contact, 0 for the default of the contact definition
+	MinSeparation int     // smallest residue index difference of a contact within a chain
+	Exponent      float64 // the width of a contact within a chain is |i-j|^Exponent angstroms
+}
+
+// QResult holds the global fraction of native contacts and the per-residue Q of every residue with contacts
+type QResult struct {
+	Q          float64
+	Residues   []*Residue // reference residues taking part in at least one native contact
+	PerResidue []float64  // Q_res of every residue in Residues
+	Contacts   int        // number of native contacts
+}
+
+// NativeQ scores structure 2 of the correspondence against the native contacts of structure 1: residue pairs of
+// aligned residues closer than the cutoff and at least MinSeparation apart in sequence (any pair across chains)
+// every contact contributes exp(-(r - rNative)^2 / (2 sigma^2)) with sigma = |i-j|^Exponent within a chain and
+// qInterchainSigma across chains; Q averages over all contacts and Q_res over the contacts of one residue
+func NativeQ(correspondences []ResidueCorrespondence, options QOptions) (QResult, error) {
+	if options.Contacts != "ca" && options.Contacts != "cb" && options.Contacts != "heavy" {
+		return QResult{}, fmt.Errorf("unknown contact definition %q (use ca, cb or heavy)", options.Contacts)
+	}
+	cutoff := options.Cutoff
+	if cutoff <= 0 {
+		cutoff = qResidueCutoff
+		if options.Contacts == "heavy" {
+			cutoff = qHeavyCutoff
+		}
+	}
+
+	pairs := AlignedResiduePairs(correspondences)
+	atoms1, atoms2 := make([][]*Atom, len(pairs)), make([][]*Atom, len(pairs))
+	for k, c := range pairs {
+		atoms1[k] = contactAtoms(c.Res1, options.Contacts)
+		atoms2[k] = contactAtoms(c.Res2, options.Contacts)
+	}
+
+	// residue pairs with contact atoms closer than the cutoff in the native structure
+	contactAtoms1 := []*Atom{}
+	owners := []int{}
+	for k := range pairs {
+		for _, atom := range atoms1[k] {
+			contactAtoms1 = append(contactAtoms1, atom)
+			owners = append(owners, k)
+		}
+	}
+	candidates := [][2]int{}
+	seen := make(map[[2]int]bool)
+	for _, pair := range NewAtomIndex(contactAtoms1, cutoff).Pairs(cutoff) {
+		i, j := owners[pair[0]], owners[pair[1]]
+		if i > j {
+			i, j = j, i
+		}
+		if i != j && !seen[[2]int{i, j}] {
+			seen[[2]int{i, j}] = true
+			candidates = append(candidates, [2]int{i, j})
+		}
+	}
+
+	sums := make([]float64, len(pairs))
+	counts := make([]int, len(pairs))
+	result := QResult{}
+	total := 0.0
+	for _, candidate := range candidates {
+		i, j := candidate[0], candidate[1]
+		res1, res2 := pairs[i].Res1, pairs[j].Res1
+		separation := res2.seqIndex - res1.seqIndex
+		if separation < 0 {
+			separation = -separation
+		}
+		if res1.chain == res2.chain && separation < options.MinSeparation {
+			continue
+		}
+		native := closestDistance(atoms1[i], atoms1[j])
+		if native >= cutoff {
+			continue
+		}
+		model := closestDistance(atoms2[i], atoms2[j])
+		if math.IsInf(model, 1) {
+			continue
+		}
+		sigma := qInterchainSigma
+		if res1.chain == res2.chain {
+			sigma = math.Pow(float64(separation), options.Exponent)
+		}
+		q := math.Exp(-(model - native) * (model - native) / (2 * sigma * sigma))
+		total += q
+		result.Contacts++
+		for _, k := range []int{i, j} {
+			sums[k] += q
+			counts[k]++
+		}
+	}
+
+	if result.Contacts > 0 {
+		result.Q = total / float64(result.Contacts)
+	}
+	for k, c := range pairs {
+		if counts[k] > 0 {
+			result.Residues = append(result.Residues, c.Res1)
+			result.PerResidue = append(result.PerResidue, sums[k]/float64(counts[k]))
+		}
+	}
+	return result, nil
+}
+
+// contactAtoms returns the atoms of a residue that define its contacts
+func contactAtoms(res *Residue, definition string) []*Atom {
+	atoms := []*Atom{}
+	for _, atom := range res.atoms {
+		if InAtomSet(atom, definition) {
+			atoms = append(atoms, atom)
+		}
+	}
+	return atoms
+}
+
+// closestDistance returns the smallest distance between two sets of atoms, or +Inf if either is empty
+func closestDistance(atoms1, atoms2 []*Atom) float64 {
+	closest := math.Inf(1)
+	for _, a := range atoms1 {
+		for _, b := range atoms2 {
+			closest = math.Min(closest, Distance(a, b))
+		}
+	}
+	return closest
+}
+
+// PrintNativeQ prints the global Q followed by the Q_res of every residue with native contacts
+func PrintNativeQ(result QResult, options QOptions) {
+	fmt.Printf("Q (%s contacts): %.4f over %d native contacts\n", options.Contacts, result.Q, result.Contacts)
+	for i, res := range result.Residues {
+		fmt.Printf("  %s %s %d%s %.4f\n", res.chain, res.amino, res.resSeq, res.iCode, result.PerResidue[i])
+	}
+	fmt.Println()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNativeQ(t *testing.T) {
+	// single alpha carbon residues of one chain at 0 and 10 and of another chain at 5 angstroms along x
+	residue := func(chain string, seqIndex int, x float64) *Residue {
+		return &Residue{amino: "ALA", chain: chain, seqIndex: seqIndex, atoms: []*Atom{{element: "CA", amino: "ALA", chain: chain, seqIndex: seqIndex, x: x}}}
+	}
+	options := QOptions{Contacts: "ca", Cutoff: 6, MinSeparation: 3, Exponent: 0.15}
+	tests := []struct {
+		name     string
+		native   []*Residue
+		model    []*Residue
+		contacts int
+		want     float64
+	}{
+		{"an unchanged contact within a chain", []*Residue{residue("A", 0, 0), residue("A", 10, 5)},
+			[]*Residue{residue("A", 0, 0), residue("A", 10, 5)}, 1, 1},
+		{"a stretched contact within a chain", []*Residue{residue("A", 0, 0), residue("A", 10, 5)},
+			[]*Residue{residue("A", 0, 0), residue("A", 10, 6)}, 1, math.Exp(-1 / (2 * math.Pow(10, 0.3)))},
+		{"residues too close in sequence", []*Residue{residue("A", 0, 0), residue("A", 2, 5)},
+			[]*Residue{residue("A", 0, 0), residue("A", 2, 6)}, 0, 0},
+		// the width across chains does not depend on how far apart the chains are numbered
+		{"a stretched contact between chains", []*Residue{residue("A", 0, 0), residue("B", 1, 5)},
+			[]*Residue{residue("A", 0, 0), residue("B", 1, 6)}, 1, math.Exp(-1 / (2 * qInterchainSigma * qInterchainSigma))},
+		{"a stretched contact between distant chains", []*Residue{residue("A", 0, 0), residue("B", 5000, 5)},
+			[]*Residue{residue("A", 0, 0), residue("B", 5000, 6)}, 1, math.Exp(-1 / (2 * qInterchainSigma * qInterchainSigma))},
+	}
+	for _, test := range tests {
+		correspondences := []ResidueCorrespondence{}
+		for k := range test.native {
+			correspondences = append(correspondences, ResidueCorrespondence{Column: k, Res1: test.native[k], Res2: test.model[k]})
+		}
+		result, err := NativeQ(correspondences, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Contacts != test.contacts || math.Abs(result.Q-test.want) > 1e-12 {
+			t.Errorf("NativeQ of %s = %v over %d contacts, want %v over %d", test.name, result.Q, result.Contacts, test.want, test.contacts)
+		}
+	}
+
+	if _, err := NativeQ(nil, QOptions{Contacts: "cg"}); err == nil {
+		t.Errorf("NativeQ with contacts cg returned no error")
+	}
+}
+
+func TestNativeQOfItself(t *testing.T) {
+	reference := joinChains(t, [2]string{"A", "1mbn"}, [2]string{"B", "1lyz"})
+	for _, contacts := range []string{"ca", "cb", "heavy"} {
+		result, err := NativeQ(identicalCorrespondences(reference, reference), QOptions{Contacts: contacts, MinSeparation: 3, Exponent: 0.15})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Contacts == 0 || math.Abs(result.Q-1) > 1e-12 {
+			t.Errorf("NativeQ(%s) of a structure with itself = %v over %d contacts, want 1", contacts, result.Q, result.Contacts)
+		}
+	}
+}
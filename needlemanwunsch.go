@@ -25,8 +25,8 @@ func ReadBLOSUM62() error {
 		}
 
 		for j, cell := range row {
-			if j == 0 || i == j {
-				continue // Skip the header column and diagonal
+			if j == 0 {
+				continue // Skip the header column
 			}
 
 			score, err := strconv.Atoi(cell)
@@ -59,10 +59,8 @@ func max(values ...int) (maxVal int, maxIndex int) {
 	return maxVal, maxIndex
 }
 
-// needlemanWunsch performs the Needleman-Wunsch algorithm for sequence alignment
-// needlemanWunsch performs the Needleman-Wunsch algorithm for sequence alignment
+// NeedlemanWunsch performs the Needleman-Wunsch algorithm for sequence alignment
 func NeedlemanWunsch(seq1, seq2 string) (string, string, string, float64) {
-	gapPenalty := -10 // Define gap penalty
 	m, n := len(seq1), len(seq2)
 	dp := make([][]int, m+1) // Initialize the scoring matrix
 	for i := range dp {
@@ -139,3 +137,25 @@ func NeedlemanWunsch(seq1, seq2 string) (string, string, string, float64) {
 	}
 	return align1, align2, matchLine, percentSimilarity
 }
+
+// NeedlemanWunschScore returns only the optimal global alignment score of two sequences
+// it keeps two rows of the scoring matrix instead of the full matrix since no traceback is needed
+func NeedlemanWunschScore(seq1, seq2 string) int {
+	m, n := len(seq1), len(seq2)
+	prev := make([]int, n+1)
+	curr := make([]int, n+1)
+	for j := 0; j <= n; j++ {
+		prev[j] = j * gapPenalty
+	}
+	for i := 1; i <= m; i++ {
+		curr[0] = i * gapPenalty
+		for j := 1; j <= n; j++ {
+			match := prev[j-1] + score(rune(seq1[i-1]), rune(seq2[j-1]))
+			delete := prev[j] + gapPenalty
+			insert := curr[j-1] + gapPenalty
+			curr[j], _ = max(match, delete, insert)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[n]
+}
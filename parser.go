@@ -2,65 +2,120 @@ package main
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 // ParsePDB takes as input a pdb file and returns a list of Atom objects
+// ATOM records are read by their fixed PDB columns so that residue numbers, insertion codes
+// and coordinates are parsed correctly even when neighbouring fields run together
 func ParsePDB(pdbFile string) []*Atom {
 	atoms := make([]*Atom, 0)
 	f, _ := os.Open(pdbFile)
 	defer f.Close()
 	scanner := bufio.NewScanner(f)
-	current_ind := 0
-	current_seq_ind := 0
+	current_ind := -1
+	current_residue := ""
+	model := 0
 	for scanner.Scan() {
-		re := regexp.MustCompile(`\s+`)
 		line := scanner.Text()
-		parts := re.Split(line, -1)
-		if parts[0] != "ATOM" {
+		if pdbColumn(line, 1, 6) == "MODEL" {
+			model, _ = strconv.Atoi(pdbColumn(line, 11, 14))
+			continue
+		}
+		if pdbColumn(line, 1, 6) != "ATOM" {
 			continue
 		}
-		number, _ := strconv.Atoi(parts[1])
-		element := parts[2]
-		amino := parts[3]
-		if amino == "MET" || len(amino) == 4 {
+		number, _ := strconv.Atoi(pdbColumn(line, 7, 11))
+		element := pdbColumn(line, 13, 16)
+		altLoc := pdbColumn(line, 17, 17)
+		amino := pdbColumn(line, 18, 20)
+		// keep only the first alternate location of disordered atoms
+		if amino == "MET" || (altLoc != "" && altLoc != "A") {
 			continue
 		}
-		chain := parts[4]
+		chain := pdbColumn(line, 22, 22)
 		if onlyChainA && chain != "A" {
 			break
 		}
-		seqIndex, _ := strconv.Atoi(parts[5])
-		x, _ := strconv.ParseFloat(parts[6], 64)
-		y, _ := strconv.ParseFloat(parts[7], 64)
+		resSeq, _ := strconv.Atoi(pdbColumn(line, 23, 26))
+		iCode := pdbColumn(line, 27, 27)
+		// a new residue starts whenever the chain, residue number or insertion code changes
+		residue := chain + ":" + strconv.Itoa(resSeq) + iCode
+		if residue != current_residue {
+			current_residue = residue
+			current_ind++
+		}
+		x, _ := strconv.ParseFloat(pdbColumn(line, 31, 38), 64)
+		y, _ := strconv.ParseFloat(pdbColumn(line, 39, 46), 64)
 		y *= -1.0
-		z, _ := strconv.ParseFloat(parts[8], 64)
-		// excludes atoms that are not part of the protein backbone
-		if element == "CA" || element == "N" || element == "O" || element == "S" {
-			radius := 0.0
-			// radii based on Pauling radii
-			if element == "CA" {
-				radius = 1.7
-			} else if element == "N" {
-				radius = 1.55
-			} else if element == "O" {
-				radius = 1.52
-			} else if element == "S" {
-				radius = 1.8
-			}
-			newAtom := &Atom{number, element, amino, chain, current_ind, x, y, z, radius}
-			atoms = append(atoms, newAtom)
+		z, _ := strconv.ParseFloat(pdbColumn(line, 47, 54), 64)
+		bFactor, _ := strconv.ParseFloat(pdbColumn(line, 61, 66), 64)
+		symbol := pdbColumn(line, 77, 78)
+		if symbol == "" {
+			symbol = elementFromName(element)
 		}
-		if current_seq_ind != seqIndex {
-			current_seq_ind = seqIndex
-			current_ind++
+		// hydrogens are not used by any analysis, every heavy atom is kept
+		if symbol == "H" || symbol == "D" {
+			continue
 		}
+		// radii based on Pauling radii
+		radius := 1.7
+		if symbol == "N" {
+			radius = 1.55
+		} else if symbol == "O" {
+			radius = 1.52
+		} else if symbol == "S" {
+			radius = 1.8
+		}
+		newAtom := &Atom{number: number, element: element, amino: amino, chain: chain, seqIndex: current_ind,
+			resSeq: resSeq, iCode: iCode, symbol: symbol, bFactor: bFactor, x: x, y: y, z: z, radius: radius, model: model}
+		atoms = append(atoms, newAtom)
 	}
 	return atoms
 }
 
+// FormatPDB returns atoms as PDB ATOM records, undoing the y negation applied by ParsePDB
+func FormatPDB(atoms []*Atom) string {
+	var sb strings.Builder
+	for _, atom := range atoms {
+		name := atom.element
+		if len(name) < 4 {
+			name = " " + name
+		}
+		sb.WriteString(fmt.Sprintf("ATOM  %5d %-4s %3s %1s%4d%1s   %8.3f%8.3f%8.3f%6.2f%6.2f          %2s\n",
+			atom.number, name, atom.amino, atom.chain, atom.resSeq, atom.iCode, atom.x, -atom.y, atom.z, 1.0, atom.bFactor, atom.symbol))
+	}
+	sb.WriteString("END\n")
+	return sb.String()
+}
+
+// elementFromName guesses the element symbol from an atom name for files without the element column,
+// using the first letter since protein atom names start with their element
+func elementFromName(name string) string {
+	for _, c := range name {
+		if c >= 'A' && c <= 'Z' {
+			return string(c)
+		}
+	}
+	return ""
+}
+
+// pdbColumn returns the trimmed contents of the 1-based, inclusive column range of a PDB line
+// columns past the end of a short line are treated as blank
+func pdbColumn(line string, start, end int) string {
+	if start > len(line) {
+		return ""
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+	return strings.TrimSpace(line[start-1 : end])
+}
+
 func ParseCamera(cameraFile string) *Camera {
 	f, _ := os.Open(cameraFile)
 	defer f.Close()
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePDBColumns(t *testing.T) {
+	// alternate locations, an insertion code, a hydrogen and short lines without the element column
+	fixture := `ATOM      1  N   GLY A   1       1.000   2.000   3.000  1.00 12.50           N
+ATOM      2  CA AGLY A   1       2.000   2.000   3.000  1.00 12.50           C
+ATOM      3  CA BGLY A   1       9.000   9.000   9.000  1.00 12.50           C
+ATOM      4  H   GLY A   1       1.000   1.000   3.000  1.00 12.50           H
+ATOM      5  CA  SER A  52       5.000   2.000   3.000  1.00 12.50           C
+ATOM      6  CA  SER A  52A      6.000   2.000   3.000  1.00 12.50           C
+ATOM      7  CA  LYS A  53       7.000   2.000   3.000
+ATOM      8  SG  CYS A  54       8.000   2.000   3.000  1.00 12.50
+END
+`
+	path := filepath.Join(t.TempDir(), "fixture.pdb")
+	if err := os.WriteFile(path, []byte(fixture), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := []Atom{
+		{number: 1, element: "N", amino: "GLY", chain: "A", seqIndex: 0, resSeq: 1, symbol: "N", bFactor: 12.5, x: 1, y: -2, z: 3, radius: 1.55},
+		{number: 2, element: "CA", amino: "GLY", chain: "A", seqIndex: 0, resSeq: 1, symbol: "C", bFactor: 12.5, x: 2, y: -2, z: 3, radius: 1.7},
+		{number: 5, element: "CA", amino: "SER", chain: "A", seqIndex: 1, resSeq: 52, symbol: "C", bFactor: 12.5, x: 5, y: -2, z: 3, radius: 1.7},
+		{number: 6, element: "CA", amino: "SER", chain: "A", seqIndex: 2, resSeq: 52, iCode: "A", symbol: "C", bFactor: 12.5, x: 6, y: -2, z: 3, radius: 1.7},
+		{number: 7, element: "CA", amino: "LYS", chain: "A", seqIndex: 3, resSeq: 53, symbol: "C", x: 7, y: -2, z: 3, radius: 1.7},
+		{number: 8, element: "SG", amino: "CYS", chain: "A", seqIndex: 4, resSeq: 54, symbol: "S", bFactor: 12.5, x: 8, y: -2, z: 3, radius: 1.8},
+	}
+
+	atoms := ParsePDB(path)
+	if len(atoms) != len(want) {
+		t.Fatalf("ParsePDB returned %d atoms, want %d", len(atoms), len(want))
+	}
+	for i, atom := range atoms {
+		if *atom != want[i] {
+			t.Errorf("ParsePDB atom %d = %+v, want %+v", i, *atom, want[i])
+		}
+	}
+}
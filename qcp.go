@@ -0,0 +1,222 @@
+package main
+
+import (
+	"math"
+)
+
+// convergence thresholds of the quaternion characteristic polynomial method
+const (
+	qcpEigenPrecision  = 1e-11 // relative precision of the largest eigenvalue
+	qcpVectorPrecision = 1e-6  // smallest squared quaternion norm accepted from a cofactor row
+	qcpMaxIterations   = 50
+)
+
+// QCP takes as input two flat coordinate arrays (x0, y0, z0, x1, ...) of equal length and returns the weighted
+// RMSD of their optimal superposition using Theobald's quaternion characteristic polynomial method
+// weights may be nil for uniform weights; if rotation is not nil it is filled with the row-major rotation that
+// moves the centered mobile coordinates onto the centered fixed coordinates. QCP does not allocate
+func QCP(fixed, mobile, weights []float64, rotation *[9]float64) float64 {
+	n := len(fixed) / 3
+	var cf, cm [3]float64
+	wSum := 0.0
+	for i := 0; i < n; i++ {
+		w := 1.0
+		if weights != nil {
+			w = weights[i]
+		}
+		for k := 0; k < 3; k++ {
+			cf[k] += w * fixed[3*i+k]
+			cm[k] += w * mobile[3*i+k]
+		}
+		wSum += w
+	}
+	if wSum == 0 {
+		if rotation != nil {
+			*rotation = [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}
+		}
+		return 0.0
+	}
+	for k := 0; k < 3; k++ {
+		cf[k] /= wSum
+		cm[k] /= wSum
+	}
+
+	var s [9]float64
+	e0 := 0.0
+	for i := 0; i < n; i++ {
+		w := 1.0
+		if weights != nil {
+			w = weights[i]
+		}
+		fx, fy, fz := fixed[3*i]-cf[0], fixed[3*i+1]-cf[1], fixed[3*i+2]-cf[2]
+		mx, my, mz := mobile[3*i]-cm[0], mobile[3*i+1]-cm[1], mobile[3*i+2]-cm[2]
+		e0 += w * (fx*fx + fy*fy + fz*fz + mx*mx + my*my + mz*mz)
+		s[0] += w * fx * mx
+		s[1] += w * fx * my
+		s[2] += w * fx * mz
+		s[3] += w * fy * mx
+		s[4] += w * fy * my
+		s[5] += w * fy * mz
+		s[6] += w * fz * mx
+		s[7] += w * fz * my
+		s[8] += w * fz * mz
+	}
+	return qcpSolve(s, e0/2, wSum, rotation)
+}
+
+// QCPSuperpose returns the transform that moves mobile onto fixed with the smallest weighted RMSD along with
+// that RMSD, computed with QCP (nil weights weigh every pair equally)
+func QCPSuperpose(fixed, mobile []vec3, weights []float64) (Transform, float64) {
+	if len(fixed) == 0 {
+		return IdentityTransform(), 0.0
+	}
+	centerFixed := weightedCentroid(fixed, weights)
+	centerMobile := weightedCentroid(mobile, weights)
+
+	var s [9]float64
+	e0, wSum := 0.0, 0.0
+	for i := range fixed {
+		w := 1.0
+		if weights != nil {
+			w = weights[i]
+		}
+		f := fixed[i].Subtract(centerFixed)
+		m := mobile[i].Subtract(centerMobile)
+		e0 += w * (f.Dot(f) + m.Dot(m))
+		s[0] += w * f.x * m.x
+		s[1] += w * f.x * m.y
+		s[2] += w * f.x * m.z
+		s[3] += w * f.y * m.x
+		s[4] += w * f.y * m.y
+		s[5] += w * f.y * m.z
+		s[6] += w * f.z * m.x
+		s[7] += w * f.z * m.y
+		s[8] += w * f.z * m.z
+		wSum += w
+	}
+
+	var rotation [9]float64
+	rmsd := qcpSolve(s, e0/2, wSum, &rotation)
+	var t Transform
+	for a := 0; a < 3; a++ {
+		for b := 0; b < 3; b++ {
+			t.Rotation[a][b] = rotation[3*a+b]
+		}
+	}
+	t.Translation = centerFixed.Subtract(t.Apply(centerMobile))
+	return t, rmsd
+}
+
+// qcpSolve finds the largest eigenvalue of the key matrix built from the cross-covariance s (s[3a+b] sums
+// fixed[a] * mobile[b]) by Newton-Raphson on its characteristic polynomial and returns the RMSD
+// e0 is half the weighted sum of squared centered coordinates of both sets and wSum the sum of weights
+func qcpSolve(s [9]float64, e0, wSum float64, rotation *[9]float64) float64 {
+	sxx, sxy, sxz := s[0], s[1], s[2]
+	syx, syy, syz := s[3], s[4], s[5]
+	szx, szy, szz := s[6], s[7], s[8]
+
+	sxx2, syy2, szz2 := sxx*sxx, syy*syy, szz*szz
+	sxy2, syz2, sxz2 := sxy*sxy, syz*syz, sxz*sxz
+	syx2, szy2, szx2 := syx*syx, szy*szy, szx*szx
+
+	syzSzymSyySzz2 := 2.0 * (syz*szy - syy*szz)
+	sxx2Syy2Szz2Syz2Szy2 := syy2 + szz2 - sxx2 + syz2 + szy2
+
+	c2 := -2.0 * (sxx2 + syy2 + szz2 + sxy2 + syx2 + sxz2 + szx2 + syz2 + szy2)
+	c1 := 8.0 * (sxx*syz*szy + syy*szx*sxz + szz*sxy*syx - sxx*syy*szz - syz*szx*sxy - szy*syx*sxz)
+
+	sxzpSzx, syzpSzy, sxypSyx := sxz+szx, syz+szy, sxy+syx
+	syzmSzy, sxzmSzx, sxymSyx := syz-szy, sxz-szx, sxy-syx
+	sxxpSyy, sxxmSyy := sxx+syy, sxx-syy
+	sxy2Sxz2Syx2Szx2 := sxy2 + sxz2 - syx2 - szx2
+
+	c0 := sxy2Sxz2Syx2Szx2*sxy2Sxz2Syx2Szx2 +
+		(sxx2Syy2Szz2Syz2Szy2+syzSzymSyySzz2)*(sxx2Syy2Szz2Syz2Szy2-syzSzymSyySzz2) +
+		(-sxzpSzx*syzmSzy+sxymSyx*(sxxmSyy-szz))*(-sxzmSzx*syzpSzy+sxymSyx*(sxxmSyy+szz)) +
+		(-sxzpSzx*syzpSzy-sxypSyx*(sxxpSyy-szz))*(-sxzmSzx*syzmSzy-sxypSyx*(sxxpSyy+szz)) +
+		(sxypSyx*syzpSzy+sxzpSzx*(sxxmSyy+szz))*(-sxymSyx*syzmSzy+sxzpSzx*(sxxpSyy+szz)) +
+		(sxypSyx*syzmSzy+sxzmSzx*(sxxmSyy-szz))*(-sxymSyx*syzpSzy+sxzmSzx*(sxxpSyy-szz))
+
+	// the largest eigenvalue is at most e0, so Newton-Raphson from e0 converges to it
+	eigen := e0
+	for iteration := 0; iteration < qcpMaxIterations; iteration++ {
+		previous := eigen
+		x2 := eigen * eigen
+		b := (x2 + c2) * eigen
+		a := b + c1
+		delta := (a*eigen + c0) / (2.0*x2*eigen + b + a)
+		eigen -= delta
+		if math.Abs(eigen-previous) < math.Abs(qcpEigenPrecision*eigen) {
+			break
+		}
+	}
+	rmsd := math.Sqrt(math.Max(0, 2.0*(e0-eigen)/wSum))
+	if rotation == nil {
+		return rmsd
+	}
+
+	// the rotation quaternion is the eigenvector of the largest eigenvalue, read from a row of cofactors
+	a11, a12, a13, a14 := sxxpSyy+szz-eigen, syzmSzy, -sxzmSzx, sxymSyx
+	a21, a22, a23, a24 := syzmSzy, sxxmSyy-szz-eigen, sxypSyx, sxzpSzx
+	a31, a32, a33, a34 := a13, a23, syy-sxx-szz-eigen, syzpSzy
+	a41, a42, a43, a44 := a14, a24, a34, szz-sxxpSyy-eigen
+
+	a3344_4334, a3244_4234 := a33*a44-a43*a34, a32*a44-a42*a34
+	a3243_4233, a3143_4133 := a32*a43-a42*a33, a31*a43-a41*a33
+	a3144_4134, a3142_4132 := a31*a44-a41*a34, a31*a42-a41*a32
+
+	q1 := a22*a3344_4334 - a23*a3244_4234 + a24*a3243_4233
+	q2 := -a21*a3344_4334 + a23*a3144_4134 - a24*a3143_4133
+	q3 := a21*a3244_4234 - a22*a3144_4134 + a24*a3142_4132
+	q4 := -a21*a3243_4233 + a22*a3143_4133 - a23*a3142_4132
+	qsqr := q1*q1 + q2*q2 + q3*q3 + q4*q4
+
+	if qsqr < qcpVectorPrecision {
+		q1 = a12*a3344_4334 - a13*a3244_4234 + a14*a3243_4233
+		q2 = -a11*a3344_4334 + a13*a3144_4134 - a14*a3143_4133
+		q3 = a11*a3244_4234 - a12*a3144_4134 + a14*a3142_4132
+		q4 = -a11*a3243_4233 + a12*a3143_4133 - a13*a3142_4132
+		qsqr = q1*q1 + q2*q2 + q3*q3 + q4*q4
+	}
+	if qsqr < qcpVectorPrecision {
+		a1324_1423, a1224_1422 := a13*a24-a14*a23, a12*a24-a14*a22
+		a1223_1322, a1124_1421 := a12*a23-a13*a22, a11*a24-a14*a21
+		a1123_1321, a1122_1221 := a11*a23-a13*a21, a11*a22-a12*a21
+
+		q1 = a42*a1324_1423 - a43*a1224_1422 + a44*a1223_1322
+		q2 = -a41*a1324_1423 + a43*a1124_1421 - a44*a1123_1321
+		q3 = a41*a1224_1422 - a42*a1124_1421 + a44*a1122_1221
+		q4 = -a41*a1223_1322 + a42*a1123_1321 - a43*a1122_1221
+		qsqr = q1*q1 + q2*q2 + q3*q3 + q4*q4
+
+		if qsqr < qcpVectorPrecision {
+			q1 = a32*a1324_1423 - a33*a1224_1422 + a34*a1223_1322
+			q2 = -a31*a1324_1423 + a33*a1124_1421 - a34*a1123_1321
+			q3 = a31*a1224_1422 - a32*a1124_1421 + a34*a1122_1221
+			q4 = -a31*a1223_1322 + a32*a1123_1321 - a33*a1122_1221
+			qsqr = q1*q1 + q2*q2 + q3*q3 + q4*q4
+		}
+	}
+	if qsqr < qcpVectorPrecision {
+		// degenerate input (all points coincide): any rotation fits equally well
+		*rotation = [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}
+		return rmsd
+	}
+
+	norm := math.Sqrt(qsqr)
+	q1, q2, q3, q4 = q1/norm, q2/norm, q3/norm, q4/norm
+	a2, x2, y2, z2 := q1*q1, q2*q2, q3*q3, q4*q4
+	xy, az, zx := q2*q3, q1*q4, q4*q2
+	ay, yz, ax := q1*q3, q3*q4, q1*q2
+
+	rotation[0] = a2 + x2 - y2 - z2
+	rotation[1] = 2 * (xy + az)
+	rotation[2] = 2 * (zx - ay)
+	rotation[3] = 2 * (xy - az)
+	rotation[4] = a2 - x2 + y2 - z2
+	rotation[5] = 2 * (yz + ax)
+	rotation[6] = 2 * (zx + ay)
+	rotation[7] = 2 * (yz - ax)
+	rotation[8] = a2 - x2 - y2 + z2
+	return rmsd
+}
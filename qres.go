@@ -4,8 +4,14 @@ import (
 	"math"
 )
 
+// qResCutoff is the alpha carbon distance in angstroms within which a residue pair counts toward qRes
+const qResCutoff = 10.0
+
 // qRes takes as input two slices of atom pointers and returns a slice of floats that corresponds to the qRes score
-// of each residue index
+// of each residue index, averaged over the residue pairs in contact in either structure.
+// this deliberately departs from the usual definition, which averages over every residue pair except direct
+// neighbors: pairs farther than qResCutoff apart in both structures are left out, so a score reflects the local
+// environment of a residue; a residue with no contacts in either structure has no environment to lose and scores 1
 func qRes(atoms1, atoms2 []*Atom) []float64 {
 	if len(atoms1) != len(atoms2) {
 		panic("residue length mismatch")
@@ -13,101 +19,86 @@ func qRes(atoms1, atoms2 []*Atom) []float64 {
 
 	n := len(atoms1)
 
-	qRes := make([]float64, n)
-
-	cMap1 := GenerateContactMap(atoms1)
-	cMap2 := GenerateContactMap(atoms2)
-
-	for i := range qRes {
-		var k float64
-		if i == 0 || i == n-1 {
-			k = 2.0
-		} else {
-			k = 3.0
-		}
-		sum := 0.0
-		for j := range cMap2 {
-			if j == i-1 || j == i || j == i+1 {
-				continue
+	// the contacts come from the spatial index, so no full contact map is built; direct neighbors are skipped
+	contacts := [][2]int{}
+	seen := make(map[[2]int]bool)
+	for _, atoms := range [][]*Atom{atoms1, atoms2} {
+		pairs, _ := ContactPairs(atoms, qResCutoff)
+		for _, pair := range pairs {
+			if pair[1]-pair[0] > 1 && !seen[pair] {
+				seen[pair] = true
+				contacts = append(contacts, pair)
 			}
-			varIJ := math.Pow(math.Abs(float64(i-j)), 0.15)
-			deltaDists := cMap1[i][j] - cMap2[i][j]
-			expression := (deltaDists * deltaDists) / (2 * varIJ)
-			sum += math.Exp(-expression)
 		}
-
-		qi := (1 / (float64(n) - k)) * sum
-
-		qRes[i] = qi
 	}
-	return qRes
-}
-
-// GenerateContactMap takes as input a slice of atom pointers and returns a
-// 2-d matrix where each cell is the distance between
-// atoms i and j
-func GenerateContactMap(atoms []*Atom) [][]float64 {
-	n := len(atoms)
 
-	M := make([][]float64, n)
-
-	for i := range M {
-		M[i] = make([]float64, n)
+	sums := make([]float64, n)
+	counts := make([]int, n)
+	for _, pair := range contacts {
+		i, j := pair[0], pair[1]
+		varIJ := math.Pow(float64(j-i), 0.15)
+		deltaDists := Distance(atoms1[i], atoms1[j]) - Distance(atoms2[i], atoms2[j])
+		expression := (deltaDists * deltaDists) / (2 * varIJ)
+		for _, k := range pair {
+			sums[k] += math.Exp(-expression)
+			counts[k]++
+		}
 	}
 
-	for i, atom1 := range atoms {
-		for j, atom2 := range atoms {
-			dist := Distance(atom1, atom2)
-
-			M[i][j] = dist
+	qRes := make([]float64, n)
+	for i := range qRes {
+		qRes[i] = 1
+		if counts[i] > 0 {
+			qRes[i] = sums[i] / float64(counts[i])
 		}
 	}
-	return M
-
+	return qRes
 }
 
-// FilterAlignedAtoms takes as input sequence strings, aligned sequence strings,
-// and atoms slices and returns two slices of
-// atoms pointers such that unaligned residues are removed
-func FilterAlignedAtoms(seq1, seq2, align1, align2 string, atoms1, atoms2 []*Atom) ([]*Atom, []*Atom) {
-	/*
-		kAtoms1 := []*Atom{}
-		kAtoms2 := []*Atom{}
-		for i := range atoms1 {
-			if atoms1[i].element == "CA" {
-				kAtoms1 = append(kAtoms1, atoms1[i])
-			}
-		}
-
-		for i := range atoms2 {
-			if atoms2[i].element == "CA" {
-				kAtoms2 = append(kAtoms2, atoms2[i])
-			}
-		}
-	*/
-
-	alignedAtoms1 := []*Atom{}
-	alignedAtoms2 := []*Atom{}
-	seqIndex1, seqIndex2 := 0, 0
-
-	for i := 0; i < len(align1); i++ {
-		// Check if the current position is not a gap in either sequence
-		if align1[i] != '-' && align2[i] != '-' {
-			// Add the atoms corresponding to the current aligned position
-			alignedAtoms1 = append(alignedAtoms1, atoms1[seqIndex1])
-			alignedAtoms2 = append(alignedAtoms2, atoms2[seqIndex2])
+// ColumnQRes returns the qRes score of every alignment column, comparing the alpha carbons of the aligned residues
+// columns with a gap or a residue without an alpha carbon get NaN, so the scores stay in register with the columns
+func ColumnQRes(correspondences []ResidueCorrespondence) []float64 {
+	atoms1, atoms2 := []*Atom{}, []*Atom{}
+	columns := []int{}
+	for _, c := range AlignedResiduePairs(correspondences) {
+		ca1, ca2 := residueAtom(c.Res1, "CA"), residueAtom(c.Res2, "CA")
+		if ca1 != nil && ca2 != nil {
+			atoms1, atoms2 = append(atoms1, ca1), append(atoms2, ca2)
+			columns = append(columns, c.Column)
 		}
+	}
+	scores := make([]float64, len(correspondences))
+	for i := range scores {
+		scores[i] = math.NaN()
+	}
+	for k, q := range qRes(atoms1, atoms2) {
+		scores[columns[k]] = q
+	}
+	return scores
+}
 
-		// Increment sequence indices if not a gap
-		if align1[i] != '-' {
-			seqIndex1++
-		}
-		if align2[i] != '-' {
-			seqIndex2++
+// ContactPairs returns every pair of atoms (i < j) closer than cutoff together with their distance, found with a
+// spatial index so that large structures do not need a full distance matrix
+func ContactPairs(atoms []*Atom, cutoff float64) ([][2]int, []float64) {
+	index := NewAtomIndex(atoms, cutoff)
+	pairs := [][2]int{}
+	dists := []float64{}
+	for _, pair := range index.Pairs(cutoff) {
+		d := Distance(atoms[pair[0]], atoms[pair[1]])
+		if d < cutoff {
+			pairs = append(pairs, pair)
+			dists = append(dists, d)
 		}
 	}
+	return pairs, dists
+}
 
-	return alignedAtoms1, alignedAtoms2
+// FilterAlignedAtoms takes as input sequence strings, aligned sequence strings,
+// and atoms slices and returns two slices of atoms pointers such that unaligned residues are removed
+// and the atoms of the atom set in every aligned residue pair are matched by atom name
+func FilterAlignedAtoms(seq1, seq2, align1, align2 string, atoms1, atoms2 []*Atom, atomSet string) ([]*Atom, []*Atom) {
+	correspondences := ResidueCorrespondences(align1, align2, Residues(atoms1), Residues(atoms2))
+	return PairAtomSet(correspondences, atomSet)
 }
 
 // Distance takes as input two atom pointers and returns a float of the distance.
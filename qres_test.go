@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQRes(t *testing.T) {
+	reference := AlphaCarbons(ParsePDB("pdbfiles/1mbn.pdb"))
+	for i, q := range qRes(reference, reference) {
+		if math.Abs(q-1) > 1e-12 {
+			t.Errorf("qRes of residue %d with itself = %v, want 1", i, q)
+		}
+	}
+
+	// moving one residue far away leaves it only the contacts it lost, each scoring close to 0
+	moved := IdentityTransform().ApplyToAtoms(reference)
+	moved[50].x += 30
+	scores := qRes(reference, moved)
+	if scores[50] > 1e-6 {
+		t.Errorf("qRes of a residue moved 30 angstroms = %v, want 0", scores[50])
+	}
+	if scores[100] != 1 {
+		t.Errorf("qRes of a residue far from the moved one = %v, want 1", scores[100])
+	}
+}
+
+// allPairsQRes is the usual qRes definition, averaging over every residue pair except direct neighbors
+func allPairsQRes(atoms1, atoms2 []*Atom) []float64 {
+	n := len(atoms1)
+	scores := make([]float64, n)
+	for i := range scores {
+		k := 3.0
+		if i == 0 || i == n-1 {
+			k = 2
+		}
+		sum := 0.0
+		for j := range atoms1 {
+			if j >= i-1 && j <= i+1 {
+				continue
+			}
+			varIJ := math.Pow(math.Abs(float64(i-j)), 0.15)
+			delta := Distance(atoms1[i], atoms1[j]) - Distance(atoms2[i], atoms2[j])
+			sum += math.Exp(-delta * delta / (2 * varIJ))
+		}
+		scores[i] = sum / (float64(n) - k)
+	}
+	return scores
+}
+
+func TestQResAgainstAllPairs(t *testing.T) {
+	// a zigzag of six residues whose pairs are all within the cutoff, and a distorted copy of it
+	chain := func(distortion float64) []*Atom {
+		atoms := []*Atom{}
+		for i := 0; i < 6; i++ {
+			atoms = append(atoms, &Atom{element: "CA", amino: "ALA", chain: "A", seqIndex: i,
+				x: 1.5 * float64(i), y: 2 * float64(i%2), z: distortion * float64(i*i)})
+		}
+		return atoms
+	}
+	reference, model := chain(0), chain(0.2)
+	want := allPairsQRes(reference, model)
+
+	// when every pair is a contact the two definitions agree
+	got := qRes(reference, model)
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-12 {
+			t.Errorf("qRes of residue %d = %v, want the all-pairs %v", i, got[i], want[i])
+		}
+	}
+
+	// a residue far from the others only changes the all-pairs scores: it has no contacts and scores 1, and the
+	// pairs it would form are left out of the scores of the others
+	far := func(atoms []*Atom, x float64) []*Atom {
+		return append(atoms, &Atom{element: "CA", amino: "ALA", chain: "A", seqIndex: len(atoms), x: x})
+	}
+	extended1, extended2 := far(chain(0), 50), far(chain(0.2), 55)
+	got = qRes(extended1, extended2)
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-12 {
+			t.Errorf("qRes of residue %d next to a far residue = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if got[6] != 1 {
+		t.Errorf("qRes of a residue without contacts = %v, want 1", got[6])
+	}
+	if allPairs := allPairsQRes(extended1, extended2); allPairs[6] > 0.5 {
+		t.Errorf("all-pairs qRes of the far residue = %v, want it to count its lost distances", allPairs[6])
+	}
+}
+
+func TestColumnQRes(t *testing.T) {
+	atoms := AlphaCarbons(ParsePDB("pdbfiles/1mbn.pdb"))[:6]
+	residues1, residues2 := Residues(atoms), Residues(IdentityTransform().ApplyToAtoms(atoms))
+	// the fifth residue of the second structure has no alpha carbon
+	residues2[4].atoms = nil
+	correspondences := ResidueCorrespondences("ABC-DEF", "AB-CDEF", residues1, residues2)
+
+	// columns with a gap or a missing alpha carbon have no score, the others compare identical positions
+	got := ColumnQRes(correspondences)
+	want := []float64{1, 1, math.NaN(), math.NaN(), 1, math.NaN(), 1}
+	if len(got) != len(want) {
+		t.Fatalf("ColumnQRes() returned %d scores, want %d", len(got), len(want))
+	}
+	for c := range want {
+		if math.IsNaN(want[c]) != math.IsNaN(got[c]) || (!math.IsNaN(want[c]) && math.Abs(got[c]-want[c]) > 1e-12) {
+			t.Errorf("ColumnQRes() column %d = %v, want %v", c, got[c], want[c])
+		}
+	}
+}
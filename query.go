@@ -7,6 +7,18 @@ import (
 	"os"
 )
 
+// FetchPDB downloads the entry for a PDB ID into pdbfiles/ and returns the local path
+// a failed download is reported but not fatal so that previously downloaded files can still be used
+func FetchPDB(pdbID string) string {
+	pdbURL := "https://files.rcsb.org/download/" + pdbID + ".pdb"
+	localPath := "pdbfiles/" + pdbID + ".pdb"
+	err := downloadPDB(pdbURL, localPath)
+	if err != nil {
+		fmt.Println("Error downloading PDB file:", err)
+	}
+	return localPath
+}
+
 // downloadPDB downloads a PDB file from the RCSB PDB database using an HTTP request
 // eliminates the need for the user to manually download PDB files
 func downloadPDB(url, destination string) error {
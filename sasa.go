@@ -0,0 +1,72 @@
+package main
+
+import "math"
+
+// parameters of the Shrake-Rupley surface calculation
+const (
+	sasaProbeRadius  = 1.4 // radius of a water molecule in angstroms
+	sasaSpherePoints = 96  // test points on the surface of every atom
+	sasaLargestAtom  = 1.8 // largest atom radius assigned by the parser (sulfur)
+)
+
+// SASA returns the solvent accessible surface area in square angstroms of every atom, the part of the sphere of
+// the atom radius plus the probe radius that lies outside the spheres of all other atoms (Shrake-Rupley)
+func SASA(atoms []*Atom) []float64 {
+	points := unitSpherePoints(sasaSpherePoints)
+	reach := 2 * (sasaLargestAtom + sasaProbeRadius)
+	index := NewAtomIndex(atoms, reach)
+	coords := AtomCoordinates(atoms)
+	areas := make([]float64, len(atoms))
+	for i, atom := range atoms {
+		r := vanDerWaalsRadius(atom) + sasaProbeRadius
+		neighbors := []int{}
+		for _, j := range index.Within(coords[i], r+sasaLargestAtom+sasaProbeRadius) {
+			if j != i && coords[i].Subtract(coords[j]).Length() < r+vanDerWaalsRadius(atoms[j])+sasaProbeRadius {
+				neighbors = append(neighbors, j)
+			}
+		}
+		exposed := 0
+		last := 0 // the neighbor that buried the previous point is the most likely to bury the next one
+		for _, p := range points {
+			point := coords[i].Add(p.Scale(r))
+			buried := false
+			for k := range neighbors {
+				j := neighbors[(last+k)%len(neighbors)]
+				rj := vanDerWaalsRadius(atoms[j]) + sasaProbeRadius
+				d := point.Subtract(coords[j])
+				if d.Dot(d) < rj*rj {
+					buried = true
+					last = (last + k) % len(neighbors)
+					break
+				}
+			}
+			if !buried {
+				exposed++
+			}
+		}
+		areas[i] = 4 * math.Pi * r * r * float64(exposed) / float64(len(points))
+	}
+	return areas
+}
+
+// TotalSASA returns the solvent accessible surface area of a set of atoms
+func TotalSASA(atoms []*Atom) float64 {
+	total := 0.0
+	for _, area := range SASA(atoms) {
+		total += area
+	}
+	return total
+}
+
+// unitSpherePoints returns n points spread evenly over the unit sphere along a golden section spiral
+func unitSpherePoints(n int) []vec3 {
+	points := make([]vec3, n)
+	increment := math.Pi * (3 - math.Sqrt(5))
+	for k := range points {
+		y := 1 - (2*float64(k)+1)/float64(n)
+		r := math.Sqrt(1 - y*y)
+		phi := float64(k) * increment
+		points[k] = vec3{r * math.Cos(phi), y, r * math.Sin(phi)}
+	}
+	return points
+}
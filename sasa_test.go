@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSASA(t *testing.T) {
+	carbon := func(chain string, seqIndex int, x float64) *Atom {
+		return &Atom{element: "CA", symbol: "C", amino: "ALA", chain: chain, seqIndex: seqIndex, x: x, radius: 1.7}
+	}
+	r := 1.7 + sasaProbeRadius
+	sphere := 4 * math.Pi * r * r
+	// two spheres of radius r at distance d each lose a cap of height r - d/2
+	capArea := func(d float64) float64 { return 2 * math.Pi * r * (r - d/2) }
+	tests := []struct {
+		name  string
+		atoms []*Atom
+		want  float64
+	}{
+		{"one atom", []*Atom{carbon("A", 0, 0)}, sphere},
+		{"two distant atoms", []*Atom{carbon("A", 0, 0), carbon("A", 1, 20)}, 2 * sphere},
+		{"two overlapping atoms", []*Atom{carbon("A", 0, 0), carbon("A", 1, 3)}, 2 * (sphere - capArea(3))},
+	}
+	for _, test := range tests {
+		// the surface points sample the spheres, so allow a few percent
+		if got := TotalSASA(test.atoms); math.Abs(got-test.want) > 0.03*test.want {
+			t.Errorf("TotalSASA of %s = %.2f, want %.2f", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBuriedArea(t *testing.T) {
+	atoms := []*Atom{
+		{element: "CA", symbol: "C", amino: "ALA", chain: "A", seqIndex: 0, radius: 1.7},
+		{element: "CA", symbol: "C", amino: "ALA", chain: "B", seqIndex: 1, x: 3, radius: 1.7},
+	}
+	interfaces := ChainInterfaces(atoms, 4)
+	if len(interfaces) != 1 {
+		t.Fatalf("ChainInterfaces found %d interfaces, want 1", len(interfaces))
+	}
+	r := 1.7 + sasaProbeRadius
+	want := 2 * 2 * math.Pi * r * (r - 1.5)
+	if got := interfaces[0].BuriedArea; math.Abs(got-want) > 0.05*want {
+		t.Errorf("BuriedArea of two carbons 3 angstroms apart = %.2f, want %.2f", got, want)
+	}
+
+	// chains out of contact bury nothing and form no interface
+	atoms[1].x = 30
+	if interfaces := ChainInterfaces(atoms, 4); len(interfaces) != 0 {
+		t.Errorf("ChainInterfaces of chains 30 angstroms apart found %d interfaces", len(interfaces))
+	}
+}
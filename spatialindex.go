@@ -0,0 +1,231 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// SpatialIndex is a uniform grid of cubic cells (a cell list) over a set of points for neighbor queries
+// that only visit the cells overlapping the query instead of every point
+// points with a NaN or infinite coordinate are left out of the grid and never returned by a query
+type SpatialIndex struct {
+	cellSize  float64
+	points    []vec3
+	cells     map[[3]int][]int
+	low, high [3]int // smallest and largest occupied cell along every axis
+	count     int    // number of points in the grid
+}
+
+// NewSpatialIndex builds a cell list over the points with the given cell edge length; queries are fastest
+// when the cell size is close to the typical query radius
+func NewSpatialIndex(points []vec3, cellSize float64) *SpatialIndex {
+	if cellSize <= 0 {
+		cellSize = 1
+	}
+	index := &SpatialIndex{cellSize: cellSize, points: points, cells: make(map[[3]int][]int)}
+	for i, p := range points {
+		if !finitePoint(p) {
+			continue
+		}
+		cell := index.cell(p)
+		if index.count == 0 {
+			index.low, index.high = cell, cell
+		}
+		for a := 0; a < 3; a++ {
+			index.low[a], index.high[a] = minInt(index.low[a], cell[a]), maxInt(index.high[a], cell[a])
+		}
+		index.cells[cell] = append(index.cells[cell], i)
+		index.count++
+	}
+	return index
+}
+
+// NewAtomIndex builds a cell list over the positions of a slice of atoms, indexed like the slice
+func NewAtomIndex(atoms []*Atom, cellSize float64) *SpatialIndex {
+	return NewSpatialIndex(AtomCoordinates(atoms), cellSize)
+}
+
+// Within returns the indices of the points no farther than radius from p, in increasing index order
+func (index *SpatialIndex) Within(p vec3, radius float64) []int {
+	found := []int{}
+	from, to, ok := index.cellRange(p, radius)
+	if !ok {
+		return found
+	}
+	for x := from[0]; x <= to[0]; x++ {
+		for y := from[1]; y <= to[1]; y++ {
+			for z := from[2]; z <= to[2]; z++ {
+				for _, i := range index.cells[[3]int{x, y, z}] {
+					d := index.points[i].Subtract(p)
+					if d.Dot(d) <= radius*radius {
+						found = append(found, i)
+					}
+				}
+			}
+		}
+	}
+	sort.Ints(found)
+	return found
+}
+
+// Nearest returns the indices of the k points closest to p, closest first
+func (index *SpatialIndex) Nearest(p vec3, k int) []int {
+	k = minInt(k, index.count)
+	if k <= 0 || !finitePoint(p) {
+		return []int{}
+	}
+	// start from the occupied cell nearest to p; a cell more than shell cells away from it along some axis is
+	// more than shell cell sizes away from p, also when p lies outside the occupied grid
+	var center [3]int
+	coords := [3]float64{p.x, p.y, p.z}
+	for a := 0; a < 3; a++ {
+		c := math.Floor(coords[a] / index.cellSize)
+		center[a] = int(math.Max(float64(index.low[a]), math.Min(float64(index.high[a]), c)))
+	}
+	lastShell := 0
+	for a := 0; a < 3; a++ {
+		lastShell = maxInt(lastShell, maxInt(center[a]-index.low[a], index.high[a]-center[a]))
+	}
+
+	// nearest holds the k closest points seen so far, closest first, with their distances
+	nearest := make([]int, 0, k)
+	dists := make([]float64, 0, k)
+	visit := func(cell [3]int) {
+		for _, i := range index.cells[cell] {
+			d := index.distance(i, p)
+			if len(nearest) == k && d >= dists[k-1] {
+				continue
+			}
+			pos := sort.SearchFloat64s(dists, d)
+			for pos < len(dists) && dists[pos] == d && nearest[pos] < i {
+				pos++
+			}
+			if len(nearest) < k {
+				nearest, dists = append(nearest, 0), append(dists, 0)
+			}
+			copy(nearest[pos+1:], nearest[pos:])
+			copy(dists[pos+1:], dists[pos:])
+			nearest[pos], dists[pos] = i, d
+		}
+	}
+	for shell := 0; shell <= lastShell; shell++ {
+		index.visitShell(center, shell, visit)
+		// every point not yet visited is more than shell cell sizes away
+		if len(nearest) == k && dists[k-1] <= float64(shell)*index.cellSize {
+			break
+		}
+	}
+	return nearest
+}
+
+// Pairs returns every pair of indices i < j whose points are no farther apart than radius, grouped by i
+func (index *SpatialIndex) Pairs(radius float64) [][2]int {
+	pairs := [][2]int{}
+	for i, p := range index.points {
+		from, to, ok := index.cellRange(p, radius)
+		if !ok || !finitePoint(p) {
+			continue
+		}
+		for x := from[0]; x <= to[0]; x++ {
+			for y := from[1]; y <= to[1]; y++ {
+				for z := from[2]; z <= to[2]; z++ {
+					for _, j := range index.cells[[3]int{x, y, z}] {
+						if j <= i {
+							continue
+						}
+						d := index.points[j].Subtract(p)
+						if d.Dot(d) <= radius*radius {
+							pairs = append(pairs, [2]int{i, j})
+						}
+					}
+				}
+			}
+		}
+	}
+	return pairs
+}
+
+// cell returns the grid cell holding a point
+func (index *SpatialIndex) cell(p vec3) [3]int {
+	return [3]int{
+		int(math.Floor(p.x / index.cellSize)),
+		int(math.Floor(p.y / index.cellSize)),
+		int(math.Floor(p.z / index.cellSize)),
+	}
+}
+
+// cellRange returns the first and last occupied cells along every axis that overlap the cube of half edge radius
+// around p, or false when the cube misses the occupied grid
+func (index *SpatialIndex) cellRange(p vec3, radius float64) ([3]int, [3]int, bool) {
+	var from, to [3]int
+	if index.count == 0 {
+		return from, to, false
+	}
+	coords := [3]float64{p.x, p.y, p.z}
+	for a := 0; a < 3; a++ {
+		first := math.Floor((coords[a] - radius) / index.cellSize)
+		last := math.Floor((coords[a] + radius) / index.cellSize)
+		// written so that NaN misses the grid
+		if !(first <= float64(index.high[a]) && last >= float64(index.low[a])) {
+			return from, to, false
+		}
+		from[a] = int(math.Max(first, float64(index.low[a])))
+		to[a] = int(math.Min(last, float64(index.high[a])))
+	}
+	return from, to, true
+}
+
+// visitShell calls visit on every occupied-grid cell exactly shell cells away from center along some axis
+func (index *SpatialIndex) visitShell(center [3]int, shell int, visit func([3]int)) {
+	var from, to [3]int
+	for a := 0; a < 3; a++ {
+		from[a], to[a] = maxInt(center[a]-shell, index.low[a]), minInt(center[a]+shell, index.high[a])
+	}
+	for x := from[0]; x <= to[0]; x++ {
+		for y := from[1]; y <= to[1]; y++ {
+			dx, dy := x-center[0], y-center[1]
+			if maxAbs(dx, dy, 0) == shell {
+				for z := from[2]; z <= to[2]; z++ {
+					visit([3]int{x, y, z})
+				}
+				continue
+			}
+			// inside the shell in x and y, so only its two faces in z
+			if z := center[2] - shell; z >= from[2] {
+				visit([3]int{x, y, z})
+			}
+			if z := center[2] + shell; shell > 0 && z <= to[2] {
+				visit([3]int{x, y, z})
+			}
+		}
+	}
+}
+
+// distance returns the distance from point i to p
+func (index *SpatialIndex) distance(i int, p vec3) float64 {
+	return index.points[i].Subtract(p).Length()
+}
+
+// finitePoint reports whether no coordinate of p is NaN or infinite
+func finitePoint(p vec3) bool {
+	for _, c := range []float64{p.x, p.y, p.z} {
+		if math.IsNaN(c) || math.IsInf(c, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// maxAbs returns the largest absolute value of three integers
+func maxAbs(a, b, c int) int {
+	if a < 0 {
+		a = -a
+	}
+	if b < 0 {
+		b = -b
+	}
+	if c < 0 {
+		c = -c
+	}
+	return maxInt(a, maxInt(b, c))
+}
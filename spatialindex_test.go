@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSpatialIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() vec3 {
+		return vec3{40*rng.Float64() - 20, 40*rng.Float64() - 20, 40*rng.Float64() - 20}
+	}
+	points := make([]vec3, 300)
+	for i := range points {
+		points[i] = random()
+	}
+	// points without a position are never found
+	points[7] = vec3{math.NaN(), 0, 0}
+	points[99] = vec3{0, math.Inf(1), 0}
+	valid := func(i int) bool { return i != 7 && i != 99 }
+
+	queries := []vec3{{0, 0, 0}, {100, -100, 50}, {-1e6, 0, 0}, {19.9, 19.9, -19.9}}
+	for i := 0; i < 20; i++ {
+		queries = append(queries, random())
+	}
+	for _, cellSize := range []float64{1, 3.7, 50} {
+		index := NewSpatialIndex(points, cellSize)
+		for _, q := range queries {
+			for _, radius := range []float64{0, 2.5, 8, 1000} {
+				want := []int{}
+				for i, p := range points {
+					if valid(i) && p.Subtract(q).Length() <= radius {
+						want = append(want, i)
+					}
+				}
+				if got := index.Within(q, radius); !sameIndices(got, want) {
+					t.Errorf("cell size %v: Within(%v, %v) = %v, want %v", cellSize, q, radius, got, want)
+				}
+			}
+			for _, k := range []int{1, 5, 40, 1000} {
+				want := []int{}
+				for i := range points {
+					if valid(i) {
+						want = append(want, i)
+					}
+				}
+				sort.Slice(want, func(a, b int) bool {
+					return points[want[a]].Subtract(q).Length() < points[want[b]].Subtract(q).Length()
+				})
+				want = want[:minInt(k, len(want))]
+				if got := index.Nearest(q, k); !sameIndices(got, want) {
+					t.Errorf("cell size %v: Nearest(%v, %d) = %v, want %v", cellSize, q, k, got, want)
+				}
+			}
+		}
+		for _, radius := range []float64{0.5, 4, 12} {
+			want := [][2]int{}
+			for i := range points {
+				for j := i + 1; j < len(points); j++ {
+					if valid(i) && valid(j) && points[i].Subtract(points[j]).Length() <= radius {
+						want = append(want, [2]int{i, j})
+					}
+				}
+			}
+			got := index.Pairs(radius)
+			sort.Slice(got, func(a, b int) bool { return got[a][0] < got[b][0] || got[a][0] == got[b][0] && got[a][1] < got[b][1] })
+			if len(got) != len(want) {
+				t.Errorf("cell size %v: Pairs(%v) found %d pairs, want %d", cellSize, radius, len(got), len(want))
+				continue
+			}
+			for k := range want {
+				if got[k] != want[k] {
+					t.Errorf("cell size %v: Pairs(%v) pair %d = %v, want %v", cellSize, radius, k, got[k], want[k])
+					break
+				}
+			}
+		}
+
+		// queries without a position find nothing
+		nan := vec3{math.NaN(), 0, 0}
+		if got := index.Within(nan, 5); len(got) != 0 {
+			t.Errorf("cell size %v: Within(NaN) = %v, want none", cellSize, got)
+		}
+		if got := index.Nearest(nan, 3); len(got) != 0 {
+			t.Errorf("cell size %v: Nearest(NaN) = %v, want none", cellSize, got)
+		}
+		if got := index.Within(vec3{}, math.NaN()); len(got) != 0 {
+			t.Errorf("cell size %v: Within with a NaN radius = %v, want none", cellSize, got)
+		}
+	}
+
+	empty := NewSpatialIndex(nil, 1)
+	if len(empty.Within(vec3{}, 10)) != 0 || len(empty.Nearest(vec3{}, 3)) != 0 || len(empty.Pairs(10)) != 0 {
+		t.Errorf("queries of an empty index found points")
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+)
+
+// default parameters of secondary structure aware alignment
+const (
+	ssMatchBonus  = 2   // added to the BLOSUM62 score when two residues share a helix or strand state
+	ssGapInside   = -20 // gap penalty for residues inside a helix or strand
+	ssGapOutside  = gapPenalty
+	ssHelixStrand = "HGIEB" // states that count as regular secondary structure
+)
+
+// ParseSecondaryStructure reads the HELIX and SHEET records of a pdb file and returns one state per residue,
+// 'H' for helix, 'E' for strand and 'C' otherwise, along with whether the file had any such records
+func ParseSecondaryStructure(pdbFile string, residues []Residue) ([]byte, bool) {
+	ss := make([]byte, len(residues))
+	for i := range ss {
+		ss[i] = 'C'
+	}
+	f, err := os.Open(pdbFile)
+	if err != nil {
+		return ss, false
+	}
+	defer f.Close()
+
+	found := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		record := pdbColumn(line, 1, 6)
+		var state byte
+		var chain, startICode, endICode string
+		var start, end int
+		if record == "HELIX" {
+			state = 'H'
+			chain = pdbColumn(line, 20, 20)
+			start, _ = strconv.Atoi(pdbColumn(line, 22, 25))
+			startICode = pdbColumn(line, 26, 26)
+			end, _ = strconv.Atoi(pdbColumn(line, 34, 37))
+			endICode = pdbColumn(line, 38, 38)
+		} else if record == "SHEET" {
+			state = 'E'
+			chain = pdbColumn(line, 22, 22)
+			start, _ = strconv.Atoi(pdbColumn(line, 23, 26))
+			startICode = pdbColumn(line, 27, 27)
+			end, _ = strconv.Atoi(pdbColumn(line, 34, 37))
+			endICode = pdbColumn(line, 38, 38)
+		} else {
+			continue
+		}
+		found = true
+		for i, res := range residues {
+			if res.chain == chain && !residueBefore(res.resSeq, res.iCode, start, startICode) && !residueBefore(end, endICode, res.resSeq, res.iCode) {
+				ss[i] = state
+			}
+		}
+	}
+	return ss, found
+}
+
+// SecondaryStructure returns the secondary structure of every residue from the HELIX/SHEET records of the
+// pdb file, or assigned by DSSP from the backbone when the file has none
+func SecondaryStructure(pdbFile string, atoms []*Atom) []byte {
+	residues := Residues(atoms)
+	ss, found := ParseSecondaryStructure(pdbFile, residues)
+	if found {
+		return ss
+	}
+	return DSSP(atoms)
+}
+
+// PositionGapPenalties returns one gap penalty per residue: inside for residues of a helix or strand
+// whose neighbours are in the same state, outside for everything else (including element ends)
+func PositionGapPenalties(ss []byte, outside, inside int) []int {
+	penalties := make([]int, len(ss))
+	for i := range ss {
+		penalties[i] = outside
+		if !isRegularStructure(ss[i]) {
+			continue
+		}
+		if i > 0 && i < len(ss)-1 && ss[i-1] == ss[i] && ss[i+1] == ss[i] {
+			penalties[i] = inside
+		}
+	}
+	return penalties
+}
+
+// NeedlemanWunschSS performs Needleman-Wunsch with a bonus for residue pairs in the same regular secondary
+// structure state and position specific gap penalties: a residue aligned to a gap costs the smaller of its
+// own penalty and the penalty at the place the gap interrupts the other sequence
+// it returns the same values as NeedlemanWunsch
+func NeedlemanWunschSS(seq1, seq2 string, ss1, ss2 []byte, gaps1, gaps2 []int, bonus int) (string, string, string, float64) {
+	m, n := len(seq1), len(seq2)
+	dp := make([][]int, m+1)
+	trace := make([][]byte, m+1)
+	for i := range dp {
+		dp[i] = make([]int, n+1)
+		trace[i] = make([]byte, n+1)
+	}
+	for i := 1; i <= m; i++ {
+		dp[i][0] = dp[i-1][0] + gaps1[i-1]
+		trace[i][0] = 'u'
+	}
+	for j := 1; j <= n; j++ {
+		dp[0][j] = dp[0][j-1] + gaps2[j-1]
+		trace[0][j] = 'l'
+	}
+	for i := 1; i <= m; i++ {
+		for j := 1; j <= n; j++ {
+			pairScore := score(rune(seq1[i-1]), rune(seq2[j-1]))
+			if ss1[i-1] == ss2[j-1] && isRegularStructure(ss1[i-1]) {
+				pairScore += bonus
+			}
+			match := dp[i-1][j-1] + pairScore
+			delete := dp[i-1][j] + minPenalty(gaps1[i-1], insertionPenalty(gaps2, j))
+			insert := dp[i][j-1] + minPenalty(gaps2[j-1], insertionPenalty(gaps1, i))
+			best, index := max(match, delete, insert)
+			dp[i][j] = best
+			trace[i][j] = "dul"[index]
+		}
+	}
+
+	align1, align2, matchLine := []byte{}, []byte{}, []byte{}
+	matchingCount := 0
+	i, j := m, n
+	for i > 0 || j > 0 {
+		switch trace[i][j] {
+		case 'd':
+			align1 = append(align1, seq1[i-1])
+			align2 = append(align2, seq2[j-1])
+			if seq1[i-1] == seq2[j-1] {
+				matchingCount++
+				matchLine = append(matchLine, '|')
+			} else {
+				matchLine = append(matchLine, ' ')
+			}
+			i--
+			j--
+		case 'u':
+			align1 = append(align1, seq1[i-1])
+			align2 = append(align2, '-')
+			matchLine = append(matchLine, ' ')
+			i--
+		default:
+			align1 = append(align1, '-')
+			align2 = append(align2, seq2[j-1])
+			matchLine = append(matchLine, ' ')
+			j--
+		}
+	}
+	reverseBytes(align1)
+	reverseBytes(align2)
+	reverseBytes(matchLine)
+
+	percentSimilarity := 0.0
+	if len(align1) > 0 {
+		percentSimilarity = float64(matchingCount) / float64(len(align1)) * 100
+	}
+	return string(align1), string(align2), string(matchLine), percentSimilarity
+}
+
+// insertionPenalty returns the penalty for opening a gap between residues k-1 and k of a sequence,
+// the weaker of the two neighbours so that gaps at element boundaries stay cheap
+func insertionPenalty(gaps []int, k int) int {
+	if k == 0 {
+		return gaps[0]
+	}
+	if k >= len(gaps) {
+		return gaps[len(gaps)-1]
+	}
+	if gaps[k-1] > gaps[k] {
+		return gaps[k-1]
+	}
+	return gaps[k]
+}
+
+// minPenalty returns the stronger (more negative) of two gap penalties
+func minPenalty(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// isRegularStructure reports whether a secondary structure state is a helix or strand
+func isRegularStructure(state byte) bool {
+	for k := 0; k < len(ssHelixStrand); k++ {
+		if ssHelixStrand[k] == state {
+			return true
+		}
+	}
+	return false
+}
+
+// residueBefore reports whether residue (resSeq1, iCode1) comes strictly before (resSeq2, iCode2)
+func residueBefore(resSeq1 int, iCode1 string, resSeq2 int, iCode2 string) bool {
+	if resSeq1 != resSeq2 {
+		return resSeq1 < resSeq2
+	}
+	return iCode1 < iCode2
+}
+
+// reverseBytes reverses a byte slice in place
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
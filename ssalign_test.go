@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPositionGapPenalties(t *testing.T) {
+	got := PositionGapPenalties([]byte("CHHHHCEEEC"), -10, -20)
+	want := []int{-10, -10, -20, -20, -10, -10, -10, -20, -10, -10}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("PositionGapPenalties = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestNeedlemanWunschSS(t *testing.T) {
+	if err := ReadBLOSUM62(); err != nil {
+		t.Fatal(err)
+	}
+	// without secondary structure the alignment is plain Needleman-Wunsch
+	for _, pair := range [][2]string{{"HEAGAWGHEE", "PAWHEAE"}, {"KKVFGRCELAAAKRHG", "KVFERCELARTLKRLG"}} {
+		coil1, coil2 := []byte(strings.Repeat("C", len(pair[0]))), []byte(strings.Repeat("C", len(pair[1])))
+		gaps1, gaps2 := PositionGapPenalties(coil1, gapPenalty, ssGapInside), PositionGapPenalties(coil2, gapPenalty, ssGapInside)
+		align1, align2, _, identity := NeedlemanWunschSS(pair[0], pair[1], coil1, coil2, gaps1, gaps2, ssMatchBonus)
+		want1, want2, _, wantIdentity := NeedlemanWunsch(pair[0], pair[1])
+		if align1 != want1 || align2 != want2 || identity != wantIdentity {
+			t.Errorf("NeedlemanWunschSS(%s, %s) without structure = %s %s, want %s %s", pair[0], pair[1], align1, align2, want1, want2)
+		}
+	}
+
+	// the bonus for a shared state outweighs the better substitution score of A-A over A-S
+	for _, test := range []struct {
+		bonus          int
+		align1, align2 string
+	}{{0, "-A", "SA"}, {5, "A-", "SA"}} {
+		align1, align2, _, _ := NeedlemanWunschSS("A", "SA", []byte("H"), []byte("HC"), []int{-10}, []int{-10, -10}, test.bonus)
+		if align1 != test.align1 || align2 != test.align2 {
+			t.Errorf("NeedlemanWunschSS(A, SA) with bonus %d = %s %s, want %s %s", test.bonus, align1, align2, test.align1, test.align2)
+		}
+	}
+
+	// plain Needleman-Wunsch deletes the first residue, the gap penalties move the deletion to the cheap tail
+	seq1, seq2 := "KKKKKKKKKK", "KKKKKKKKK"
+	coil1, coil2 := []byte(strings.Repeat("C", len(seq1))), []byte(strings.Repeat("C", len(seq2)))
+	gaps1 := []int{-20, -20, -20, -20, -20, -20, -20, -10, -10, -10}
+	gaps2 := []int{-10, -10, -10, -10, -10, -10, -10, -10, -10}
+	align1, align2, _, _ := NeedlemanWunschSS(seq1, seq2, coil1, coil2, gaps1, gaps2, 0)
+	if gap := strings.Index(align2, "-"); gap < 7 || align1 != seq1 {
+		t.Errorf("NeedlemanWunschSS placed the deletion at column %d: %s %s", gap, align1, align2)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// limits of the chain mapping search: groups of identical chains larger than symmetryMaxPermuted are searched over
+// cyclic equivalents only instead of all permutations, and when the combinations of all groups exceed
+// symmetryMaxMappings the largest groups are made cyclic too, or failing that each group is optimized in turn
+const (
+	symmetryMaxPermuted = 6
+	symmetryMaxMappings = 1000
+)
+
+// ChainMapping is an assignment of the chains of structure 2 to the chains of structure 1 with the RMSD it gives
+type ChainMapping struct {
+	Pairs      []ChainPair
+	RMSD       float64
+	Transform  Transform
+	LabelRMSD  float64 // RMSD of the initial sequence based mapping, for comparison
+	Candidates int     // number of mappings evaluated
+}
+
+// SymmetricRMSD pairs the chains of two assemblies by sequence and then searches the mappings that permute chains
+// of structure 2 with identical sequences, returning the mapping with the smallest RMSD over the atom set
+// groups of up to symmetryMaxPermuted identical chains are fully permuted; larger groups are treated as cyclic
+// and only the rotations and reflections of the chains' angular order about the assembly axis are tried
+// at most symmetryMaxMappings combinations are searched exhaustively, beyond that the groups are searched one at a time
+func SymmetricRMSD(atoms1, atoms2 []*Atom, atomSet string, numProcs int) ChainMapping {
+	pairs := PairChains(atoms1, atoms2, numProcs)
+
+	// pairs whose chains in structure 2 share a sequence can exchange partners
+	groupIndex := make(map[string]int)
+	groups := [][]int{}
+	for k, pair := range pairs {
+		g, ok := groupIndex[pair.Chain2.sequence]
+		if !ok {
+			g = len(groups)
+			groupIndex[pair.Chain2.sequence] = g
+			groups = append(groups, []int{})
+		}
+		groups[g] = append(groups[g], k)
+	}
+
+	// atoms paired by every chain of structure 1 with every exchangeable chain of structure 2
+	paired1 := make([][][]*Atom, len(pairs))
+	paired2 := make([][][]*Atom, len(pairs))
+	for _, group := range groups {
+		for _, a := range group {
+			paired1[a] = make([][]*Atom, len(group))
+			paired2[a] = make([][]*Atom, len(group))
+			for b, other := range group {
+				paired1[a][b], paired2[a][b] = FilterAlignedAtoms(pairs[a].Chain1.sequence, pairs[other].Chain2.sequence,
+					pairs[a].Align1, pairs[a].Align2, pairs[a].Chain1.atoms, pairs[other].Chain2.atoms, atomSet)
+			}
+		}
+	}
+	candidates, exhaustive := symmetryCandidates(pairs, groups)
+
+	result := ChainMapping{RMSD: math.Inf(1)}
+	choice := make([][]int, len(groups))
+	// evaluate superposes the atoms paired by the current choice of every group and keeps the best mapping
+	evaluate := func() float64 {
+		fixed, mobile := []*Atom{}, []*Atom{}
+		for h, group := range groups {
+			for a, k := range group {
+				fixed = append(fixed, paired1[k][choice[h][a]]...)
+				mobile = append(mobile, paired2[k][choice[h][a]]...)
+			}
+		}
+		t, rmsd := QCPSuperpose(AtomCoordinates(fixed), AtomCoordinates(mobile), nil)
+		result.Candidates++
+		identity := true
+		for _, perm := range choice {
+			for a, b := range perm {
+				identity = identity && a == b
+			}
+		}
+		if identity {
+			result.LabelRMSD = rmsd
+		}
+		if rmsd < result.RMSD {
+			result.RMSD, result.Transform = rmsd, t
+			result.Pairs = make([]ChainPair, len(pairs))
+			copy(result.Pairs, pairs)
+			for h, group := range groups {
+				for a, k := range group {
+					result.Pairs[k].Chain2 = pairs[group[choice[h][a]]].Chain2
+				}
+			}
+		}
+		return rmsd
+	}
+
+	// the labels as given, which the cyclic mappings need not include
+	for g, group := range groups {
+		choice[g] = make([]int, len(group))
+		for a := range group {
+			choice[g][a] = a
+		}
+	}
+	best := evaluate()
+
+	if exhaustive {
+		var search func(g int)
+		search = func(g int) {
+			if g == len(groups) {
+				evaluate()
+				return
+			}
+			for _, perm := range candidates[g] {
+				choice[g] = perm
+				search(g + 1)
+			}
+		}
+		search(0)
+		return result
+	}
+
+	// too many combinations: improve on the labels one group at a time with the others fixed, sweeping over the
+	// groups until no group changes
+	for changed := true; changed; {
+		changed = false
+		for g := range groups {
+			current := choice[g]
+			for _, perm := range candidates[g] {
+				choice[g] = perm
+				if rmsd := evaluate(); rmsd < best {
+					best, current, changed = rmsd, perm, true
+				}
+			}
+			choice[g] = current
+		}
+	}
+	return result
+}
+
+// symmetryCandidates returns the chain mappings to try for every group of exchangeable pairs: all permutations
+// of groups of up to symmetryMaxPermuted chains and the cyclic mappings of larger ones, making the largest groups
+// cyclic until the combinations number at most symmetryMaxMappings; it reports whether they can all be searched
+func symmetryCandidates(pairs []ChainPair, groups [][]int) ([][][]int, bool) {
+	cyclic := func(group []int) [][]int {
+		chains1, chains2 := make([]*Chain, len(group)), make([]*Chain, len(group))
+		for i, k := range group {
+			chains1[i], chains2[i] = pairs[k].Chain1, pairs[k].Chain2
+		}
+		return cyclicMappings(angularOrder(chains1), angularOrder(chains2))
+	}
+	candidates := make([][][]int, len(groups))
+	for g, group := range groups {
+		if len(group) <= symmetryMaxPermuted {
+			candidates[g] = permutations(len(group))
+		} else {
+			candidates[g] = cyclic(group)
+		}
+	}
+	for mappingCount(candidates) > symmetryMaxMappings {
+		// the fully permuted group that shrinks the most when only its cyclic mappings are tried
+		largest := -1
+		for g, group := range groups {
+			if len(candidates[g]) > 2*len(group) && (largest < 0 || len(candidates[g]) > len(candidates[largest])) {
+				largest = g
+			}
+		}
+		if largest < 0 {
+			return candidates, false
+		}
+		candidates[largest] = cyclic(groups[largest])
+	}
+	return candidates, true
+}
+
+// mappingCount returns the number of combinations of one candidate per group, stopping once it exceeds
+// symmetryMaxMappings
+func mappingCount(candidates [][][]int) int {
+	count := 1
+	for _, group := range candidates {
+		count *= len(group)
+		if count > symmetryMaxMappings {
+			return count
+		}
+	}
+	return count
+}
+
+// permutations returns every ordering of 0..n-1
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	result := [][]int{}
+	for _, perm := range permutations(n - 1) {
+		for pos := 0; pos <= len(perm); pos++ {
+			next := make([]int, 0, n)
+			next = append(next, perm[:pos]...)
+			next = append(next, n-1)
+			next = append(next, perm[pos:]...)
+			result = append(result, next)
+		}
+	}
+	return result
+}
+
+// cyclicMappings returns the mappings that send the chains of order1 onto those of order2 shifted around the ring,
+// in the same and in the opposite direction
+func cyclicMappings(order1, order2 []int) [][]int {
+	n := len(order1)
+	mappings := [][]int{}
+	for shift := 0; shift < n; shift++ {
+		for _, direction := range []int{1, -1} {
+			perm := make([]int, n)
+			for i := range order1 {
+				perm[order1[i]] = order2[((shift+direction*i)%n+n)%n]
+			}
+			mappings = append(mappings, perm)
+		}
+	}
+	return mappings
+}
+
+// angularOrder returns the indices of the chains sorted by the angle of their centroids around the normal of the
+// plane that best fits the centroids, the ring order of a cyclic assembly
+func angularOrder(chains []*Chain) []int {
+	centroids := make([]vec3, len(chains))
+	for i, chain := range chains {
+		centroids[i] = centroid(AtomCoordinates(chain.atoms))
+	}
+	center := centroid(centroids)
+
+	// the normal is the direction of least spread of the centroids
+	cov := mat.NewDense(3, 3, nil)
+	for _, c := range centroids {
+		d := c.Subtract(center)
+		v := [3]float64{d.x, d.y, d.z}
+		for a := 0; a < 3; a++ {
+			for b := 0; b < 3; b++ {
+				cov.Set(a, b, cov.At(a, b)+v[a]*v[b])
+			}
+		}
+	}
+	var svd mat.SVD
+	normal := vec3{0, 0, 1}
+	if svd.Factorize(cov, mat.SVDFull) {
+		var u mat.Dense
+		svd.UTo(&u)
+		normal = vec3{u.At(0, 2), u.At(1, 2), u.At(2, 2)}
+	}
+
+	axis := centroids[0].Subtract(center)
+	axis = axis.Subtract(normal.Scale(axis.Dot(normal)))
+	other := normal.Cross(axis)
+	angles := make([]float64, len(chains))
+	order := make([]int, len(chains))
+	for i, c := range centroids {
+		d := c.Subtract(center)
+		angles[i] = math.Atan2(d.Dot(other), d.Dot(axis))
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return angles[order[a]] < angles[order[b]] })
+	return order
+}
+
+// PrintChainMapping prints the chain mapping with the smallest RMSD next to the RMSD of the labels as given
+func PrintChainMapping(mapping ChainMapping) {
+	fmt.Printf("Symmetry-aware RMSD: %.3f over %d chain mappings (%.3f with the initial chain mapping)\n", mapping.RMSD, mapping.Candidates, mapping.LabelRMSD)
+	for _, pair := range mapping.Pairs {
+		fmt.Printf("  %s -> %s\n", pair.Chain1.id, pair.Chain2.id)
+	}
+	PrintTransform(mapping.Transform)
+}
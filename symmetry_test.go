@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// ringAssembly returns copies of each structure placed around the z axis, one ring per structure stacked along z;
+// copy k of a structure goes to ring position positions[k] and gets its own chain ID
+func ringAssembly(t *testing.T, ids []string, positions []int) []*Atom {
+	t.Helper()
+	assembly := []*Atom{}
+	offset := 0
+	for g, id := range ids {
+		for k, position := range positions {
+			angle := 2 * math.Pi * float64(position) / float64(len(positions))
+			c, s := math.Cos(angle), math.Sin(angle)
+			place := Transform{Rotation: [3][3]float64{{c, -s, 0}, {s, c, 0}, {0, 0, 1}}, Translation: vec3{0, 0, 100 * float64(g)}}
+			atoms := ParsePDB("pdbfiles/" + id + ".pdb")
+			for _, atom := range atoms {
+				p := place.Apply(vec3{atom.x + 50, atom.y, atom.z})
+				atom.x, atom.y, atom.z = p.x, p.y, p.z
+				atom.chain = strconv.Itoa(g) + string(rune('A'+k))
+				atom.seqIndex += offset
+			}
+			offset = atoms[len(atoms)-1].seqIndex + 1
+			assembly = append(assembly, atoms...)
+		}
+	}
+	return assembly
+}
+
+func TestSymmetryCandidates(t *testing.T) {
+	// single atom chains around a ring, one group of exchangeable pairs per entry of sizes
+	groupsOf := func(sizes ...int) ([]ChainPair, [][]int) {
+		pairs, groups := []ChainPair{}, [][]int{}
+		for _, size := range sizes {
+			group := []int{}
+			for k := 0; k < size; k++ {
+				angle := 2 * math.Pi * float64(k) / float64(size)
+				chain := &Chain{atoms: []*Atom{{x: math.Cos(angle), y: math.Sin(angle)}}}
+				group = append(group, len(pairs))
+				pairs = append(pairs, ChainPair{Chain1: chain, Chain2: chain})
+			}
+			groups = append(groups, group)
+		}
+		return pairs, groups
+	}
+	tests := []struct {
+		sizes      []int
+		counts     []int
+		exhaustive bool
+	}{
+		{[]int{4}, []int{24}, true},
+		{[]int{8}, []int{16}, true},
+		{[]int{5, 3}, []int{120, 6}, true},
+		// both groups of six are cut down to their cyclic mappings
+		{[]int{6, 6}, []int{12, 12}, true},
+		// cyclic mappings do not shrink groups of three, so the groups are searched one at a time
+		{[]int{3, 3, 3, 3}, []int{6, 6, 6, 6}, false},
+	}
+	for _, test := range tests {
+		candidates, exhaustive := symmetryCandidates(groupsOf(test.sizes...))
+		counts := make([]int, len(candidates))
+		for g := range candidates {
+			counts[g] = len(candidates[g])
+		}
+		if !sameIndices(counts, test.counts) || exhaustive != test.exhaustive {
+			t.Errorf("symmetryCandidates(%v) = %v mappings, exhaustive %v, want %v, %v", test.sizes, counts, exhaustive, test.counts, test.exhaustive)
+		}
+	}
+}
+
+func TestSymmetricRMSD(t *testing.T) {
+	if err := ReadBLOSUM62(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		ids    []string
+		copies int
+	}{
+		{"a cyclic ring of eight", []string{"1mbn"}, 8},
+		{"four rings of three", []string{"1mbn", "1lyz", "1cll", "1a6p"}, 3},
+	}
+	for _, test := range tests {
+		// structure 2 is the same assembly with the first two chains of every ring in each other's place,
+		// which no rigid motion undoes
+		positions := make([]int, test.copies)
+		for k := range positions {
+			positions[k] = k
+		}
+		atoms1 := ringAssembly(t, test.ids, positions)
+		positions[0], positions[1] = 1, 0
+		atoms2 := ringAssembly(t, test.ids, positions)
+		mapping := SymmetricRMSD(atoms1, atoms2, "ca", 2)
+		if mapping.RMSD > 1e-3 || mapping.LabelRMSD < 1 {
+			t.Errorf("SymmetricRMSD of %s = %v (%v with the labels), want 0", test.name, mapping.RMSD, mapping.LabelRMSD)
+		}
+		if mapping.Candidates > symmetryMaxMappings {
+			t.Errorf("SymmetricRMSD of %s evaluated %d mappings, want at most %d", test.name, mapping.Candidates, symmetryMaxMappings)
+		}
+		for _, pair := range mapping.Pairs {
+			if pair.Chain1.id[0] != pair.Chain2.id[0] {
+				t.Errorf("SymmetricRMSD of %s mapped chain %s onto %s", test.name, pair.Chain1.id, pair.Chain2.id)
+			}
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// parameters of the structure based alignment
+const (
+	tmGapOpen         = -0.6 // gap opening penalty of the structural dynamic programming
+	tmMaxIterations   = 30   // maximum rounds of superposition and dynamic programming per seed
+	tmAlignedDistance = 5.0  // pairs closer than this (in angstroms) are marked as structurally aligned
+)
+
+// StructuralAlignment is the result of a sequence independent structural alignment
+type StructuralAlignment struct {
+	Align1, Align2 string
+	MatchLine      string    // ':' pairs closer than 5 angstroms, '.' other aligned pairs
+	Transform      Transform // moves structure 2 onto structure 1
+	TMScore1       float64   // TM-score normalized by the length of structure 1
+	TMScore2       float64   // TM-score normalized by the length of structure 2
+	RMSD           float64   // RMSD of the aligned pairs under Transform
+	AlignedLength  int
+}
+
+// TMAlign aligns two structures by their alpha carbons without using sequence similarity
+// initial alignments come from gapless threading and from aligning secondary structure, each is then refined by
+// alternating superposition with dynamic programming on the TM-score weighted distance between residues
+func TMAlign(atoms1, atoms2 []*Atom) StructuralAlignment {
+	residues1, residues2 := Residues(atoms1), Residues(atoms2)
+	seq1, seq2 := GetQuerySequence(atoms1), GetQuerySequence(atoms2)
+	x, y := ResidueCoordinates(residues1), ResidueCoordinates(residues2)
+	if len(x) == 0 || len(y) == 0 {
+		return StructuralAlignment{}
+	}
+
+	// structure 2 is moved onto structure 1, and the shorter structure sets the distance scale while searching
+	lNorm := len(x)
+	if len(y) < lNorm {
+		lNorm = len(y)
+	}
+	d0 := TMScoreD0(lNorm)
+
+	seeds := [][]int{
+		gaplessThreading(x, y, lNorm),
+		secondaryStructureSeed(CASecondaryStructure(x), CASecondaryStructure(y)),
+	}
+
+	bestScore := -1.0
+	var bestMap []int
+	for _, seed := range seeds {
+		alignment, score := refineAlignment(x, y, seed, d0, lNorm)
+		if score > bestScore {
+			bestScore, bestMap = score, alignment
+		}
+	}
+
+	// final detailed TM-score search for both normalizations
+	fixed, mobile := alignedPairs(x, y, bestMap)
+	result := StructuralAlignment{AlignedLength: len(fixed)}
+	result.TMScore1, result.Transform = TMScoreSearch(fixed, mobile, len(x), 1)
+	result.TMScore2, _ = TMScoreSearch(fixed, mobile, len(y), 1)
+	result.RMSD = CoordinateRMSD(fixed, mobile, Superpose(fixed, mobile))
+	result.Align1, result.Align2, result.MatchLine = alignmentStrings(seq1, seq2, bestMap, x, y, result.Transform)
+	return result
+}
+
+// ResidueCoordinates returns one point per residue, the alpha carbon or the first atom if it has none
+func ResidueCoordinates(residues []Residue) []vec3 {
+	coords := make([]vec3, len(residues))
+	for i := range residues {
+		coords[i] = residueCoordinate(&residues[i])
+	}
+	return coords
+}
+
+// residueCoordinate returns the position of the alpha carbon of a residue, or of its first atom if it has none
+func residueCoordinate(res *Residue) vec3 {
+	atom := res.atoms[0]
+	for _, a := range res.atoms {
+		if a.element == "CA" {
+			atom = a
+			break
+		}
+	}
+	return vec3{atom.x, atom.y, atom.z}
+}
+
+// CASecondaryStructure assigns helix ('H'), strand ('E') or coil ('C') to every residue
+// from the distances between alpha carbons up to four residues apart
+func CASecondaryStructure(ca []vec3) []byte {
+	n := len(ca)
+	ss := make([]byte, n)
+	for i := range ss {
+		ss[i] = 'C'
+	}
+	near := func(d, target, tolerance float64) bool { return math.Abs(d-target) < tolerance }
+	for i := 2; i+2 < n; i++ {
+		d13 := ca[i-2].Subtract(ca[i]).Length()
+		d14 := ca[i-2].Subtract(ca[i+1]).Length()
+		d15 := ca[i-2].Subtract(ca[i+2]).Length()
+		d24 := ca[i-1].Subtract(ca[i+1]).Length()
+		d25 := ca[i-1].Subtract(ca[i+2]).Length()
+		d35 := ca[i].Subtract(ca[i+2]).Length()
+		if near(d13, 5.45, 2.1) && near(d14, 5.18, 2.1) && near(d15, 6.37, 2.1) &&
+			near(d24, 5.45, 2.1) && near(d25, 5.18, 2.1) && near(d35, 5.45, 2.1) {
+			ss[i] = 'H'
+		} else if near(d13, 6.1, 1.42) && near(d14, 10.4, 1.42) && near(d15, 13.0, 1.42) &&
+			near(d24, 6.1, 1.42) && near(d25, 10.4, 1.42) && near(d35, 6.1, 1.42) {
+			ss[i] = 'E'
+		}
+	}
+	return ss
+}
+
+// gaplessThreading tries every offset of structure 2 along structure 1 without gaps
+// and returns the alignment map of the offset with the highest TM-score
+func gaplessThreading(x, y []vec3, lNorm int) []int {
+	minOverlap := lNorm / 2
+	if minOverlap < 5 {
+		minOverlap = 5
+	}
+	bestScore := -1.0
+	var best []int
+	for offset := -len(y) + 1; offset < len(x); offset++ {
+		alignment := make([]int, len(x))
+		count := 0
+		for i := range alignment {
+			j := i - offset
+			if j >= 0 && j < len(y) {
+				alignment[i] = j
+				count++
+			} else {
+				alignment[i] = -1
+			}
+		}
+		if count < minOverlap {
+			continue
+		}
+		fixed, mobile := alignedPairs(x, y, alignment)
+		score := quickTMScore(fixed, mobile, lNorm)
+		if score > bestScore {
+			bestScore, best = score, alignment
+		}
+	}
+	if best == nil {
+		best = make([]int, len(x))
+		for i := range best {
+			best[i] = -1
+			if i < len(y) {
+				best[i] = i
+			}
+		}
+	}
+	return best
+}
+
+// secondaryStructureSeed aligns two secondary structure strings, scoring one for identical states
+func secondaryStructureSeed(ss1, ss2 []byte) []int {
+	score := make([][]float64, len(ss1))
+	for i := range score {
+		score[i] = make([]float64, len(ss2))
+		for j := range score[i] {
+			if ss1[i] == ss2[j] {
+				score[i][j] = 1
+			}
+		}
+	}
+	return structuralDP(score, -1.0)
+}
+
+// refineAlignment alternates between superposing the aligned pairs and re-aligning the structures by dynamic
+// programming on the similarity 1/(1+(d/d0)^2) until the alignment stops changing, returning the best alignment
+func refineAlignment(x, y []vec3, alignment []int, d0 float64, lNorm int) ([]int, float64) {
+	fixed, mobile := alignedPairs(x, y, alignment)
+	bestScore := quickTMScore(fixed, mobile, lNorm)
+	best := alignment
+	current := alignment
+	for _, gapOpen := range []float64{tmGapOpen, 0.0} {
+		for iteration := 0; iteration < tmMaxIterations; iteration++ {
+			fixed, mobile := alignedPairs(x, y, current)
+			if len(fixed) < 3 {
+				break
+			}
+			_, t := TMScoreSearch(fixed, mobile, lNorm, maxInt(1, len(fixed)/10))
+
+			score := make([][]float64, len(x))
+			for i := range x {
+				score[i] = make([]float64, len(y))
+				for j := range y {
+					d := x[i].Subtract(t.Apply(y[j])).Length()
+					score[i][j] = 1 / (1 + (d/d0)*(d/d0))
+				}
+			}
+			next := structuralDP(score, gapOpen)
+
+			fixed, mobile = alignedPairs(x, y, next)
+			tm := quickTMScore(fixed, mobile, lNorm)
+			if tm > bestScore {
+				bestScore, best = tm, next
+			}
+			if sameIndices(next, current) {
+				break
+			}
+			current = next
+		}
+		current = best
+	}
+	return best, bestScore
+}
+
+// structuralDP performs global dynamic programming with free end gaps and a penalty only for opening a gap,
+// returning for every residue of structure 1 the index of its partner in structure 2 or -1
+func structuralDP(score [][]float64, gapOpen float64) []int {
+	m := len(score)
+	n := 0
+	if m > 0 {
+		n = len(score[0])
+	}
+	val := make([][]float64, m+1)
+	diag := make([][]bool, m+1)
+	for i := range val {
+		val[i] = make([]float64, n+1)
+		diag[i] = make([]bool, n+1)
+	}
+	for i := 1; i <= m; i++ {
+		for j := 1; j <= n; j++ {
+			d := val[i-1][j-1] + score[i-1][j-1]
+			h := val[i-1][j]
+			if diag[i-1][j] {
+				h += gapOpen
+			}
+			v := val[i][j-1]
+			if diag[i][j-1] {
+				v += gapOpen
+			}
+			if d >= h && d >= v {
+				val[i][j], diag[i][j] = d, true
+			} else if v >= h {
+				val[i][j] = v
+			} else {
+				val[i][j] = h
+			}
+		}
+	}
+
+	alignment := make([]int, m)
+	for i := range alignment {
+		alignment[i] = -1
+	}
+	i, j := m, n
+	for i > 0 && j > 0 {
+		if diag[i][j] {
+			alignment[i-1] = j - 1
+			i--
+			j--
+			continue
+		}
+		h := val[i-1][j]
+		if diag[i-1][j] {
+			h += gapOpen
+		}
+		if val[i][j] == h {
+			i--
+		} else {
+			j--
+		}
+	}
+	return alignment
+}
+
+// quickTMScore estimates the TM-score of aligned pairs from a superposition of all pairs refined by
+// fitting only the pairs within the search cutoff a few times
+func quickTMScore(fixed, mobile []vec3, lNorm int) float64 {
+	if len(fixed) < 3 {
+		return 0.0
+	}
+	d0 := TMScoreD0(lNorm)
+	dSearch := math.Max(4.5, math.Min(d0, 8.0))
+	t := Superpose(fixed, mobile)
+	best := TMScoreWithTransform(fixed, mobile, t, lNorm)
+	for iteration := 0; iteration < 3; iteration++ {
+		selected := closePairs(fixed, mobile, t, dSearch)
+		t = Superpose(selectPoints(fixed, selected), selectPoints(mobile, selected))
+		best = math.Max(best, TMScoreWithTransform(fixed, mobile, t, lNorm))
+	}
+	return best
+}
+
+// alignedPairs returns the coordinates of the residue pairs in an alignment map
+func alignedPairs(x, y []vec3, alignment []int) ([]vec3, []vec3) {
+	fixed := make([]vec3, 0)
+	mobile := make([]vec3, 0)
+	for i, j := range alignment {
+		if j >= 0 {
+			fixed = append(fixed, x[i])
+			mobile = append(mobile, y[j])
+		}
+	}
+	return fixed, mobile
+}
+
+// alignmentStrings converts an alignment map into gapped sequences and a match line marking close pairs
+func alignmentStrings(seq1, seq2 string, alignment []int, x, y []vec3, t Transform) (string, string, string) {
+	align1, align2, matchLine := []byte{}, []byte{}, []byte{}
+	j := 0
+	for i := range alignment {
+		if alignment[i] < 0 {
+			align1 = append(align1, seq1[i])
+			align2 = append(align2, '-')
+			matchLine = append(matchLine, ' ')
+			continue
+		}
+		for ; j < alignment[i]; j++ {
+			align1 = append(align1, '-')
+			align2 = append(align2, seq2[j])
+			matchLine = append(matchLine, ' ')
+		}
+		align1 = append(align1, seq1[i])
+		align2 = append(align2, seq2[j])
+		if x[i].Subtract(t.Apply(y[j])).Length() < tmAlignedDistance {
+			matchLine = append(matchLine, ':')
+		} else {
+			matchLine = append(matchLine, '.')
+		}
+		j++
+	}
+	for ; j < len(seq2); j++ {
+		align1 = append(align1, '-')
+		align2 = append(align2, seq2[j])
+		matchLine = append(matchLine, ' ')
+	}
+	return string(align1), string(align2), string(matchLine)
+}
+
+// PrintStructuralAlignment prints the alignment, TM-scores, RMSD and transform of a structural alignment
+func PrintStructuralAlignment(result StructuralAlignment) {
+	fmt.Println(result.Align1)
+	fmt.Println(result.MatchLine)
+	fmt.Println(result.Align2)
+	fmt.Printf("Aligned length: %d, RMSD: %.2f\n", result.AlignedLength, result.RMSD)
+	fmt.Printf("TM-score: %.4f (normalized by structure 1), %.4f (normalized by structure 2)\n", result.TMScore1, result.TMScore2)
+	PrintTransform(result.Transform)
+}
+
+// PrintTransform prints the rotation matrix and translation vector of a transform in PDB file coordinates
+func PrintTransform(t Transform) {
+	t = t.PDBFrame()
+	fmt.Println("Rotation matrix:")
+	for _, row := range t.Rotation {
+		fmt.Printf("  %9.5f %9.5f %9.5f\n", row[0], row[1], row[2])
+	}
+	fmt.Printf("Translation: %.3f %.3f %.3f\n\n", t.Translation.x, t.Translation.y, t.Translation.z)
+}
+
+// maxInt returns the larger of two integers
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
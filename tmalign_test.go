@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTMAlignRotatedCopy(t *testing.T) {
+	atoms := ParsePDB("pdbfiles/1lyz.pdb")
+	rotation := Transform{Rotation: [3][3]float64{{0, 0, 1}, {1, 0, 0}, {0, 1, 0}}, Translation: vec3{12, -7, 30}}
+	for name, copied := range map[string][]*Atom{"itself": ParsePDB("pdbfiles/1lyz.pdb"), "a rotated copy": rotation.ApplyToAtoms(atoms)} {
+		result := TMAlign(atoms, copied)
+		n := len(Residues(atoms))
+		if result.AlignedLength != n || result.Align1 != result.Align2 {
+			t.Errorf("TMAlign of 1lyz with %s aligned %d of %d residues", name, result.AlignedLength, n)
+		}
+		if math.Abs(result.TMScore1-1) > 1e-6 || math.Abs(result.TMScore2-1) > 1e-6 || result.RMSD > 1e-6 {
+			t.Errorf("TMAlign of 1lyz with %s = TM-scores %v and %v, RMSD %v, want 1, 1 and 0", name, result.TMScore1, result.TMScore2, result.RMSD)
+		}
+		// the transform moves the copy back onto the original
+		if rmsd := CoordinateRMSD(AtomCoordinates(atoms), AtomCoordinates(copied), result.Transform); rmsd > 1e-6 {
+			t.Errorf("TMAlign transform leaves %s %v angstroms RMSD from 1lyz", name, rmsd)
+		}
+	}
+}
+
+func TestClosePairsStops(t *testing.T) {
+	fixed := []vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	far := []vec3{{0, 0, 0}, {1e6, 0, 0}, {0, 1e6, 0}, {0, 0, 1e6}}
+	undefined := []vec3{{math.NaN(), 0, 0}, {math.NaN(), 0, 0}, {math.NaN(), 0, 0}, {math.NaN(), 0, 0}}
+	if got := closePairs(fixed, fixed, IdentityTransform(), 1.5); len(got) != 4 {
+		t.Errorf("closePairs of identical points selected %v, want all 4", got)
+	}
+	if got := closePairs(fixed, far, IdentityTransform(), 4.5); !sameIndices(got, []int{0}) {
+		t.Errorf("closePairs of distant points selected %v, want only the pair in reach", got)
+	}
+	if got := closePairs(fixed, undefined, IdentityTransform(), 4.5); len(got) != 0 {
+		t.Errorf("closePairs of NaN coordinates selected %v, want none", got)
+	}
+}
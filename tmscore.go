@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// distance cutoffs of the GDT and MaxSub scores in angstroms
+var (
+	gdtTSCutoffs = []float64{1, 2, 4, 8}
+	gdtHACutoffs = []float64{0.5, 1, 2, 4}
+)
+
+// distance cutoff and d0 of the MaxSub score in angstroms
+const maxSubCutoff = 3.5
+
+// closePairs widens its cutoff by closePairsStep angstroms at most closePairsMaxSteps times
+const (
+	closePairsStep     = 0.5
+	closePairsMaxSteps = 20
+)
+
+// SimilarityScores holds the superposition based similarity scores of two structures under a residue correspondence
+type SimilarityScores struct {
+	AlignedLength      int     // number of residue pairs
+	TMScore1, TMScore2 float64 // TM-score normalized by the length of structure 1 and structure 2
+	GDTTS, GDTHA       float64 // global distance test scores normalized by the length of structure 1
+	MaxSub             float64 // MaxSub score normalized by the length of structure 1
+	Transform          Transform
+}
+
+// StructureSimilarity computes TM-score, GDT_TS, GDT_HA and MaxSub from the alpha carbons of the aligned
+// residue pairs, each maximized over superpositions; length1 and length2 are the residue counts of the structures
+// and structure 1 is taken as the reference for GDT and MaxSub
+func StructureSimilarity(correspondences []ResidueCorrespondence, length1, length2 int) SimilarityScores {
+	pairs := AlignedResiduePairs(correspondences)
+	fixed, mobile := make([]vec3, len(pairs)), make([]vec3, len(pairs))
+	for i, c := range pairs {
+		fixed[i] = residueCoordinate(c.Res1)
+		mobile[i] = residueCoordinate(c.Res2)
+	}
+
+	step := maxInt(1, len(pairs)/40)
+	scores := SimilarityScores{AlignedLength: len(pairs)}
+	scores.TMScore1, scores.Transform = TMScoreSearch(fixed, mobile, length1, step)
+	scores.TMScore2, _ = TMScoreSearch(fixed, mobile, length2, step)
+	for _, cutoff := range gdtTSCutoffs {
+		scores.GDTTS += GDTScore(fixed, mobile, length1, cutoff, step) / float64(len(gdtTSCutoffs))
+	}
+	for _, cutoff := range gdtHACutoffs {
+		scores.GDTHA += GDTScore(fixed, mobile, length1, cutoff, step) / float64(len(gdtHACutoffs))
+	}
+	scores.MaxSub = MaxSubScore(fixed, mobile, length1, step)
+	return scores
+}
+
+// PrintSimilarityScores prints the TM-score, GDT and MaxSub scores of a comparison
+func PrintSimilarityScores(scores SimilarityScores) {
+	fmt.Printf("Structural similarity over %d aligned residues:\n", scores.AlignedLength)
+	fmt.Printf("TM-score: %.4f (normalized by structure 1), %.4f (normalized by structure 2)\n", scores.TMScore1, scores.TMScore2)
+	fmt.Printf("GDT_TS: %.2f, GDT_HA: %.2f, MaxSub: %.4f\n\n", 100*scores.GDTTS, 100*scores.GDTHA, scores.MaxSub)
+}
+
+// TMScoreD0 returns the distance scale d0 used by the TM-score for a structure of length n
+func TMScoreD0(n int) float64 {
+	if n <= 21 {
+		return 0.5
+	}
+	d0 := 1.24*math.Cbrt(float64(n)-15) - 1.8
+	if d0 < 0.5 {
+		d0 = 0.5
+	}
+	return d0
+}
+
+// TMScoreWithTransform returns the TM-score of the aligned pairs (fixed[i], mobile[i]) after moving mobile
+// by the transform, normalized by lNorm residues
+func TMScoreWithTransform(fixed, mobile []vec3, t Transform, lNorm int) float64 {
+	if lNorm == 0 {
+		return 0.0
+	}
+	d0 := TMScoreD0(lNorm)
+	sum := 0.0
+	for i := range fixed {
+		d := fixed[i].Subtract(t.Apply(mobile[i])).Length()
+		sum += 1 / (1 + (d/d0)*(d/d0))
+	}
+	return sum / float64(lNorm)
+}
+
+// TMScoreSearch finds the superposition of the aligned pairs (fixed[i], mobile[i]) that maximizes the TM-score
+// normalized by lNorm residues; superpositions are seeded from fragments of decreasing length and refined by
+// repeatedly fitting the pairs closer than a distance cutoff. step sets the spacing of fragment start positions
+func TMScoreSearch(fixed, mobile []vec3, lNorm, step int) (float64, Transform) {
+	if len(fixed) == 0 || lNorm == 0 {
+		return 0.0, IdentityTransform()
+	}
+	d0 := TMScoreD0(lNorm)
+	dSearch := math.Max(4.5, math.Min(d0, 8.0))
+	return superpositionSearch(fixed, mobile, step, dSearch, func(t Transform) float64 {
+		return TMScoreWithTransform(fixed, mobile, t, lNorm)
+	})
+}
+
+// GDTScore returns the largest fraction of lNorm residues whose aligned pairs can be superposed within cutoff
+// angstroms, the building block of GDT_TS and GDT_HA
+func GDTScore(fixed, mobile []vec3, lNorm int, cutoff float64, step int) float64 {
+	if len(fixed) == 0 || lNorm == 0 {
+		return 0.0
+	}
+	best, _ := superpositionSearch(fixed, mobile, step, cutoff, func(t Transform) float64 {
+		within := 0
+		for i := range fixed {
+			if fixed[i].Subtract(t.Apply(mobile[i])).Length() <= cutoff {
+				within++
+			}
+		}
+		return float64(within) / float64(lNorm)
+	})
+	return best
+}
+
+// MaxSubScore returns the MaxSub score of the aligned pairs normalized by lNorm residues: the largest sum of
+// 1 / (1 + (d/3.5)^2) over pairs superposed within 3.5 angstroms
+func MaxSubScore(fixed, mobile []vec3, lNorm, step int) float64 {
+	if len(fixed) == 0 || lNorm == 0 {
+		return 0.0
+	}
+	best, _ := superpositionSearch(fixed, mobile, step, maxSubCutoff, func(t Transform) float64 {
+		sum := 0.0
+		for i := range fixed {
+			d := fixed[i].Subtract(t.Apply(mobile[i])).Length()
+			if d <= maxSubCutoff {
+				sum += 1 / (1 + (d/maxSubCutoff)*(d/maxSubCutoff))
+			}
+		}
+		return sum / float64(lNorm)
+	})
+	return best
+}
+
+// superpositionSearch returns the highest score over superpositions of the aligned pairs seeded from fragments
+// of decreasing length and refined by repeatedly fitting the pairs closer than dSearch, along with the transform
+// that reached it
+func superpositionSearch(fixed, mobile []vec3, step int, dSearch float64, score func(Transform) float64) (float64, Transform) {
+	n := len(fixed)
+	best, bestTransform := -1.0, IdentityTransform()
+	if n == 0 {
+		return 0.0, bestTransform
+	}
+	if n < 3 {
+		t := Superpose(fixed, mobile)
+		return score(t), t
+	}
+	if step < 1 {
+		step = 1
+	}
+
+	minFragment := 4
+	if n < minFragment {
+		minFragment = n
+	}
+	for fragment := n; fragment >= minFragment; fragment /= 2 {
+		for start := 0; start+fragment <= n; start += step {
+			selected := make([]int, fragment)
+			for k := range selected {
+				selected[k] = start + k
+			}
+			for iteration := 0; iteration < 20; iteration++ {
+				t := Superpose(selectPoints(fixed, selected), selectPoints(mobile, selected))
+				value := score(t)
+				if value > best {
+					best, bestTransform = value, t
+				}
+				next := closePairs(fixed, mobile, t, dSearch)
+				if sameIndices(next, selected) {
+					break
+				}
+				selected = next
+			}
+			if fragment == n {
+				break
+			}
+		}
+		if fragment == minFragment {
+			break
+		}
+	}
+	return best, bestTransform
+}
+
+// closePairs returns the indices of the pairs closer than cutoff after moving mobile by the transform
+// the cutoff is relaxed until at least three pairs are selected, giving up with fewer after closePairsMaxSteps
+func closePairs(fixed, mobile []vec3, t Transform, cutoff float64) []int {
+	dists := make([]float64, len(fixed))
+	for i := range fixed {
+		dists[i] = fixed[i].Subtract(t.Apply(mobile[i])).Length()
+	}
+	selected := make([]int, 0)
+	for step := 0; step <= closePairsMaxSteps; step++ {
+		selected = selected[:0]
+		for i, d := range dists {
+			if d < cutoff {
+				selected = append(selected, i)
+			}
+		}
+		if len(selected) >= 3 || len(selected) == len(fixed) {
+			break
+		}
+		cutoff += closePairsStep
+	}
+	return selected
+}
+
+// selectPoints returns the points at the given indices
+func selectPoints(points []vec3, indices []int) []vec3 {
+	selected := make([]vec3, len(indices))
+	for k, i := range indices {
+		selected[k] = points[i]
+	}
+	return selected
+}
+
+// sameIndices reports whether two index slices are identical
+func sameIndices(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimilarityScoresOfPartlyMovedHelix(t *testing.T) {
+	// a helix whose last 40 residues are shifted 60 angstroms away, seen from an arbitrary frame
+	move := Transform{Rotation: [3][3]float64{{0, -1, 0}, {0, 0, 1}, {-1, 0, 0}}, Translation: vec3{-4, 9, 17}}
+	fixed, mobile := make([]vec3, 100), make([]vec3, 100)
+	for k := range fixed {
+		angle := float64(k) * 100 * math.Pi / 180
+		fixed[k] = vec3{2.3 * math.Cos(angle), 2.3 * math.Sin(angle), 1.5 * float64(k)}
+		mobile[k] = fixed[k]
+		if k >= 60 {
+			mobile[k] = mobile[k].Add(vec3{60, 0, 0})
+		}
+		mobile[k] = move.Apply(mobile[k])
+	}
+
+	for _, cutoff := range []float64{0.5, 1, 2, 4, 8} {
+		if got := GDTScore(fixed, mobile, 100, cutoff, 1); math.Abs(got-0.6) > 1e-9 {
+			t.Errorf("GDTScore within %v angstroms = %v, want 0.6", cutoff, got)
+		}
+	}
+	if got := GDTScore(fixed, mobile, 120, 1, 1); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("GDTScore normalized by 120 residues = %v, want 0.5", got)
+	}
+	if got := MaxSubScore(fixed, mobile, 100, 1); math.Abs(got-0.6) > 1e-9 {
+		t.Errorf("MaxSubScore = %v, want 0.6", got)
+	}
+	// the shifted residues still add a little to the TM-score, 1/(1+(60/d0)^2) each
+	d0 := TMScoreD0(100)
+	want := 0.6 + 0.4/(1+(60/d0)*(60/d0))
+	score, transform := TMScoreSearch(fixed, mobile, 100, 1)
+	if math.Abs(score-want) > 1e-6 {
+		t.Errorf("TMScoreSearch = %v, want %v", score, want)
+	}
+	if rmsd := CoordinateRMSD(fixed[:60], mobile[:60], transform); rmsd > 1e-6 {
+		t.Errorf("TMScoreSearch transform leaves the unmoved residues %v angstroms apart", rmsd)
+	}
+}
+
+func TestTMScoreD0(t *testing.T) {
+	for _, test := range []struct {
+		n    int
+		want float64
+	}{{10, 0.5}, {21, 0.5}, {100, 1.24*math.Cbrt(85) - 1.8}, {300, 1.24*math.Cbrt(285) - 1.8}} {
+		if got := TMScoreD0(test.n); math.Abs(got-test.want) > 1e-12 {
+			t.Errorf("TMScoreD0(%d) = %v, want %v", test.n, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Transform is a rigid body motion, applied to a point p as Rotation * p + Translation
+type Transform struct {
+	Rotation    [3][3]float64
+	Translation vec3
+}
+
+// IdentityTransform returns the transform that leaves every point in place
+func IdentityTransform() Transform {
+	return Transform{Rotation: [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}}
+}
+
+// Apply returns the point p moved by the transform
+func (t Transform) Apply(p vec3) vec3 {
+	r := t.Rotation
+	return vec3{
+		r[0][0]*p.x + r[0][1]*p.y + r[0][2]*p.z + t.Translation.x,
+		r[1][0]*p.x + r[1][1]*p.y + r[1][2]*p.z + t.Translation.y,
+		r[2][0]*p.x + r[2][1]*p.y + r[2][2]*p.z + t.Translation.z,
+	}
+}
+
+// Superpose takes as input two equally long slices of points and returns the transform that moves
+// mobile onto fixed with the smallest RMSD (computed with QCP)
+func Superpose(fixed, mobile []vec3) Transform {
+	t, _ := QCPSuperpose(fixed, mobile, nil)
+	return t
+}
+
+// WeightedSuperpose returns the transform that moves mobile onto fixed with the smallest weighted RMSD,
+// where weights holds one non-negative weight per pair (nil weighs every pair equally)
+// it solves the Kabsch problem by SVD and serves as the reference for QCPSuperpose
+func WeightedSuperpose(fixed, mobile []vec3, weights []float64) Transform {
+	n := len(fixed)
+	if n == 0 {
+		return IdentityTransform()
+	}
+	centerFixed := weightedCentroid(fixed, weights)
+	centerMobile := weightedCentroid(mobile, weights)
+
+	// weighted covariance matrix of the centered point sets
+	h := mat.NewDense(3, 3, nil)
+	for i := 0; i < n; i++ {
+		w := 1.0
+		if weights != nil {
+			w = weights[i]
+		}
+		m := mobile[i].Subtract(centerMobile).Scale(w)
+		f := fixed[i].Subtract(centerFixed)
+		mc := [3]float64{m.x, m.y, m.z}
+		fc := [3]float64{f.x, f.y, f.z}
+		for a := 0; a < 3; a++ {
+			for b := 0; b < 3; b++ {
+				h.Set(a, b, h.At(a, b)+mc[a]*fc[b])
+			}
+		}
+	}
+
+	var svd mat.SVD
+	if ok := svd.Factorize(h, mat.SVDFull); !ok {
+		return IdentityTransform()
+	}
+	var u, v mat.Dense
+	svd.UTo(&u)
+	svd.VTo(&v)
+
+	// correct for a reflection so that the result is a proper rotation
+	d := 1.0
+	if mat.Det(&u)*mat.Det(&v) < 0 {
+		d = -1.0
+	}
+
+	var t Transform
+	for a := 0; a < 3; a++ {
+		for b := 0; b < 3; b++ {
+			t.Rotation[a][b] = v.At(a, 0)*u.At(b, 0) + v.At(a, 1)*u.At(b, 1) + d*v.At(a, 2)*u.At(b, 2)
+		}
+	}
+	t.Translation = centerFixed.Subtract(t.Apply(centerMobile))
+	return t
+}
+
+// ApplyToAtoms returns copies of the atoms moved by the transform, leaving the originals untouched
+func (t Transform) ApplyToAtoms(atoms []*Atom) []*Atom {
+	moved := make([]*Atom, len(atoms))
+	for i, atom := range atoms {
+		copied := *atom
+		p := t.Apply(vec3{atom.x, atom.y, atom.z})
+		copied.x, copied.y, copied.z = p.x, p.y, p.z
+		moved[i] = &copied
+	}
+	return moved
+}
+
+// PDBFrame returns the transform expressed in the coordinate frame of the PDB file
+// ParsePDB negates y for rendering, so the rotation and translation are conjugated by that reflection
+func (t Transform) PDBFrame() Transform {
+	flip := [3]float64{1, -1, 1}
+	var pdb Transform
+	for a := 0; a < 3; a++ {
+		for b := 0; b < 3; b++ {
+			pdb.Rotation[a][b] = flip[a] * t.Rotation[a][b] * flip[b]
+		}
+	}
+	pdb.Translation = vec3{t.Translation.x, -t.Translation.y, t.Translation.z}
+	return pdb
+}
+
+// CoordinateRMSD returns the RMSD between fixed and mobile after moving mobile by the transform
+func CoordinateRMSD(fixed, mobile []vec3, t Transform) float64 {
+	if len(fixed) == 0 {
+		return 0.0
+	}
+	sum := 0.0
+	for i := range fixed {
+		d := fixed[i].Subtract(t.Apply(mobile[i]))
+		sum += d.Dot(d)
+	}
+	return math.Sqrt(sum / float64(len(fixed)))
+}
+
+// AtomCoordinates returns the positions of a slice of atoms as vectors
+func AtomCoordinates(atoms []*Atom) []vec3 {
+	coords := make([]vec3, len(atoms))
+	for i, atom := range atoms {
+		coords[i] = vec3{atom.x, atom.y, atom.z}
+	}
+	return coords
+}
+
+// centroid returns the average of a slice of points
+func centroid(points []vec3) vec3 {
+	return weightedCentroid(points, nil)
+}
+
+// weightedCentroid returns the weighted average of a slice of points (nil weights count every point equally)
+func weightedCentroid(points []vec3, weights []float64) vec3 {
+	sum := vec3{0, 0, 0}
+	total := 0.0
+	for i, p := range points {
+		w := 1.0
+		if weights != nil {
+			w = weights[i]
+		}
+		sum = sum.Add(p.Scale(w))
+		total += w
+	}
+	if total == 0 {
+		return sum
+	}
+	return sum.Scale(1.0 / total)
+}
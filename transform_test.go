@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestWeightedSuperpose(t *testing.T) {
+	// rotate a small point cloud by 90 degrees about z and shift it, then recover the transform
+	want := Transform{Rotation: [3][3]float64{{0, -1, 0}, {1, 0, 0}, {0, 0, 1}}, Translation: vec3{1, -2, 3}}
+	fixed := []vec3{{0, 0, 0}, {1.5, 0, 0}, {0, 2, 0}, {0, 0, 3}, {1, 1, 1}}
+	mobile := make([]vec3, len(fixed))
+	inverse := Transform{Rotation: [3][3]float64{{0, 1, 0}, {-1, 0, 0}, {0, 0, 1}}}
+	for i, p := range fixed {
+		mobile[i] = inverse.Apply(p.Subtract(want.Translation))
+	}
+
+	for _, weights := range [][]float64{nil, {1, 2, 3, 4, 5}} {
+		got := WeightedSuperpose(fixed, mobile, weights)
+		for a := 0; a < 3; a++ {
+			for b := 0; b < 3; b++ {
+				if math.Abs(got.Rotation[a][b]-want.Rotation[a][b]) > 1e-9 {
+					t.Errorf("WeightedSuperpose rotation = %v, want %v", got.Rotation, want.Rotation)
+				}
+			}
+		}
+		if got.Translation.Subtract(want.Translation).Length() > 1e-9 {
+			t.Errorf("WeightedSuperpose translation = %v, want %v", got.Translation, want.Translation)
+		}
+		if rmsd := CoordinateRMSD(fixed, mobile, got); rmsd > 1e-9 {
+			t.Errorf("CoordinateRMSD after WeightedSuperpose = %v, want 0", rmsd)
+		}
+	}
+}
+
+func TestQCPMatchesSVD(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 20; trial++ {
+		n := 5 + rng.Intn(50)
+		fixed, mobile := make([]vec3, n), make([]vec3, n)
+		weights := make([]float64, n)
+		flatFixed, flatMobile := make([]float64, 3*n), make([]float64, 3*n)
+		for i := 0; i < n; i++ {
+			fixed[i] = vec3{rng.NormFloat64() * 10, rng.NormFloat64() * 10, rng.NormFloat64() * 10}
+			mobile[i] = vec3{rng.NormFloat64() * 10, rng.NormFloat64() * 10, rng.NormFloat64() * 10}
+			weights[i] = rng.Float64()
+			flatFixed[3*i], flatFixed[3*i+1], flatFixed[3*i+2] = fixed[i].x, fixed[i].y, fixed[i].z
+			flatMobile[3*i], flatMobile[3*i+1], flatMobile[3*i+2] = mobile[i].x, mobile[i].y, mobile[i].z
+		}
+
+		for _, w := range [][]float64{nil, weights} {
+			svd := WeightedSuperpose(fixed, mobile, w)
+			qcp, rmsd := QCPSuperpose(fixed, mobile, w)
+			for a := 0; a < 3; a++ {
+				for b := 0; b < 3; b++ {
+					if math.Abs(qcp.Rotation[a][b]-svd.Rotation[a][b]) > 1e-6 {
+						t.Fatalf("QCPSuperpose rotation = %v, SVD gives %v", qcp.Rotation, svd.Rotation)
+					}
+				}
+			}
+			var rotation [9]float64
+			if flat := QCP(flatFixed, flatMobile, w, &rotation); math.Abs(flat-rmsd) > 1e-9 {
+				t.Errorf("QCP on flat coordinates = %v, QCPSuperpose gives %v", flat, rmsd)
+			}
+			if w == nil {
+				if want := CoordinateRMSD(fixed, mobile, svd); math.Abs(rmsd-want) > 1e-6 {
+					t.Errorf("QCP RMSD = %v, SVD gives %v", rmsd, want)
+				}
+			}
+		}
+	}
+
+	flat := []float64{0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3}
+	var rotation [9]float64
+	if allocs := testing.AllocsPerRun(10, func() { QCP(flat, flat, nil, &rotation) }); allocs != 0 {
+		t.Errorf("QCP allocates %v times per call, want 0", allocs)
+	}
+}
@@ -8,6 +8,11 @@ const (
 	viewportWidth  = viewportHeight * float64(imageWidth) / float64(imageHeight)
 )
 
+const (
+	gapPenalty  = -10 // linear gap penalty used by Needleman-Wunsch
+	shuffleSeed = 1   // base seed so that significance estimates are reproducible
+)
+
 var (
 	camera                       *Camera
 	light                        *Light
@@ -20,6 +25,7 @@ var (
 	matchLine                    string
 	percentSimilarity            float64
 	alignedAtoms1, alignedAtoms2 []*Atom
+	maxRMSF                      float64 // largest RMSF of the rendered structures, the top of the RMSF color scale
 )
 
 var (
@@ -32,6 +38,9 @@ var (
 	colorByChain            = false
 	colorByAtom             = false
 	colorByDifferingRegions = false
+	colorByRMSF             = false
+	colorByInterface        = false
+	showInteractions        = true
 	onlyChainA              = false
 	renderProtein1          = false
 	renderProtein2          = false
@@ -72,9 +81,28 @@ type Atom struct {
 	element  string
 	amino    string
 	chain    string
-	seqIndex int
+	seqIndex int    // running residue index within the parsed structure
+	resSeq   int    // residue number from the PDB file
+	iCode    string // insertion code from the PDB file
+	symbol   string // element symbol
+	bFactor  float64
 	x, y, z  float64
 	radius   float64
+	model    int     // MODEL serial number, 0 for files without MODEL records
+	rmsf     float64 // root mean square fluctuation across an ensemble, used for coloring
+
+	interfaceRes bool   // belongs to a residue at an interface between chains, used for coloring
+	interaction  string // type of the interaction drawn by this sphere of a dashed line, empty for real atoms
+}
+
+// Residue groups the atoms that share a residue index
+type Residue struct {
+	amino    string
+	chain    string
+	seqIndex int
+	resSeq   int
+	iCode    string
+	atoms    []*Atom
 }
 
 type Color struct {